@@ -1,8 +1,10 @@
 package jsonslice
 
 import (
+	"bytes"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -12,6 +14,7 @@ const (
 	cOpBool   = 1 << iota
 	cOpNull   = 1 << iota
 	cOpRegexp = 1 << iota
+	cOpArray  = 1 << iota // raw array, compared as a string unless used with "in"
 )
 
 /*
@@ -27,21 +30,28 @@ func init() {
 
   <filter> : <expression> [ <operator> <expression> ]   <--- .single
   <expression> : <operand> [ <operator> <operand> ]
-  <compare> : /(==)|(!=)|(>)|(<)|(>=)|(<=)/
-  <operand> : <number> | <string> | <bool> | <jsonpath>
+  <compare> : /(==)|(!=)|(>)|(<)|(>=)|(<=)|(in)|(nin)/
+  <operand> : <number> | <string> | <bool> | <null> | <variable> | <jsonpath> | <function> | <list>
   <number> : /-?[0-9]+(\.[0-9]*?)?((E|e)[0-9]+)?/
   <string> : /"[^"]*"/
   <bool> : /(true)|(false)/
+  <null> : /null/
   <jsonpath> : /[@$].+/           <--- .exists
+  <variable> : /@index|@length/  <--- element position, array length
+  <function> : /type\(<jsonpath>\)/
+  <list> : /\[<number>|<string>|<bool>|<null>(,...)\]/  <--- right operand of in, nin
   <operator> : /[+-/*] | (>=,<=,==,!=,>,<) | (&&,||)/
 */
 
 type tFilter struct {
-	toks []*tToken
+	toks   []*tToken
+	src    word // the expression as written
+	length bool // @length is used, the array must be counted first
 }
 type tToken struct {
 	Operand  *tOperand
 	Operator byte
+	Fold     bool // compare strings case-insensitively (Options.CaseInsensitiveValues)
 }
 type tOperand struct {
 	Type   int // cOp*
@@ -50,11 +60,13 @@ type tOperand struct {
 	Str    []byte
 	Node   *tNode
 	Regexp *regexp.Regexp
+	Func   word // function applied to the Node value
+	Var    byte // pseudo-variable: 'i' for @index, 'l' for @length
 }
 
-var operator = [...]string{">=", "<=", "==", "!=", "=~", ">", "<", "&&", "||"}
-var operatorCode = [...]byte{'G', 'L', 'E', 'N', 'R', 'g', 'l', '&', '|'}
-var operatorPrecedence = map[byte]int{'&': 1, '|': 1, 'g': 2, 'l': 2, 'E': 2, 'N': 2, 'R': 2, 'G': 2, 'L': 2, '+': 3, '-': 3, '*': 4, '/': 4}
+var operator = [...]string{">=", "<=", "==", "!=", "=~", ">", "<", "&&", "||", "in", "nin"}
+var operatorCode = [...]byte{'G', 'L', 'E', 'N', 'R', 'g', 'l', '&', '|', 'I', 'O'}
+var operatorPrecedence = map[byte]int{'&': 1, '|': 1, 'g': 2, 'l': 2, 'E': 2, 'N': 2, 'R': 2, 'G': 2, 'L': 2, 'I': 2, 'O': 2, '+': 3, '-': 3, '*': 4, '/': 4}
 
 type stack struct {
 	s []*tToken
@@ -93,6 +105,7 @@ func (s *stack) get() []*tToken {
 
 func readFilter(path []byte, i int, nod *tNode) (int, error) {
 	l := len(path)
+	s := i
 
 	// lexer
 	tokens := make([]*tToken, 0)
@@ -110,6 +123,10 @@ func readFilter(path []byte, i int, nod *tNode) (int, error) {
 		}
 	}
 
+	if len(tokens) == 0 {
+		return i, errEmptyFilter
+	}
+
 	//parser
 	opStack := new(stack)
 	result := new(stack)
@@ -137,7 +154,18 @@ func readFilter(path []byte, i int, nod *tNode) (int, error) {
 		result.push(top)
 	}
 
-	nod.Filter = &tFilter{toks: reverse(result.get())}
+	nod.Filter = &tFilter{toks: reverse(result.get()), src: path[s:i]}
+	// an operator lacking an operand or an operand lacking an operator is a syntax error
+	if rest, err := checkOperands(nod.Filter.toks); err != nil {
+		return i, err
+	} else if len(rest) > 0 {
+		return i, errOperatorExpected
+	}
+	for _, tok := range tokens {
+		if tok.Operand != nil && tok.Operand.Var > 0 {
+			nod.Filter.length = nod.Filter.length || tok.Operand.Var == 'l'
+		}
+	}
 
 	return i, nil
 }
@@ -156,6 +184,10 @@ func nextToken(path []byte, i int, prevOperator byte) (int, *tToken, error) {
 		if path[i] == ')' {
 			break
 		}
+		// end of array index without closing the filter
+		if path[i] == ']' {
+			return i, nil, errFilterUnterminated
+		}
 		// regexp
 		if path[i] == '/' && prevOperator == 'R' {
 			return readRegexp(path, i)
@@ -168,20 +200,69 @@ func nextToken(path []byte, i int, prevOperator byte) (int, *tToken, error) {
 		if path[i] == '"' || path[i] == '\'' {
 			return readString(path, i)
 		}
+		// list
+		if path[i] == '[' {
+			return readList(path, i)
+		}
+		// function
+		if isFunction(path, i) {
+			return readFunction(path, i)
+		}
 		// bool
 		if path[i] == 't' || path[i] == 'f' {
 			return readBool(path, i)
 		}
+		// null
+		if path[i] == 'n' && !bytes.HasPrefix(path[i:], []byte("nin")) {
+			return readNull(path, i)
+		}
+		// pseudo-variable
+		if path[i] == '@' {
+			if j, tok := readVariable(path, i); tok != nil {
+				return j, tok, nil
+			}
+		}
 		return tokComplex(path, i)
 	}
 	return i, tok, nil
 }
 
+var filterVariables = [...]string{"index", "length"}
+
+// readVariable reads @index or @length, returns nil token if there is none at i
+func readVariable(path []byte, i int) (int, *tToken) {
+	for _, name := range filterVariables {
+		e := i + 1 + len(name)
+		if e > len(path) || string(path[i+1:e]) != name {
+			continue
+		}
+		if e < len(path) && (isWordChar(path[e]) || bytein(path[e], []byte{'.', '[', '('})) {
+			continue
+		}
+		return e, &tToken{Operand: &tOperand{Type: cOpNumber, Var: name[0]}}
+	}
+	return i, nil
+}
+
+// tPosition is the position of the array element a filter is applied to: @index and @length
+type tPosition struct {
+	index  int
+	length int
+}
+
+// arrayLength counts the array elements starting at i if the filter refers to @length
+func (f *tFilter) arrayLength(input []byte, i int) (int, error) {
+	if !f.length {
+		return 0, nil
+	}
+	return countElements(input, i)
+}
+
 func tokComplex(path []byte, i int) (int, *tToken, error) {
 	l := len(path)
 	// jsonpath node
 	if path[i] == '@' || path[i] == '$' {
-		nod, j, err := parsePath(path[i:])
+		nod, j, err := parsePath(path[i:], false)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -197,7 +278,7 @@ func tokComplex(path []byte, i int) (int, *tToken, error) {
 		return i, nil, errUnexpectedEOT
 	}
 	for ic, cmp := range operator {
-		if string(path[i:i+len(cmp)]) == cmp {
+		if i+len(cmp) <= l && string(path[i:i+len(cmp)]) == cmp {
 			return i + len(cmp), &tToken{Operator: operatorCode[ic]}, nil
 		}
 	}
@@ -241,6 +322,46 @@ func readString(path []byte, i int) (int, *tToken, error) {
 	return i, &tToken{Operand: &tOperand{Type: cOpString, Str: path[s:e]}}, nil
 }
 
+// readList reads a list of literals like ['a','b'] or [1,2] as an array operand,
+// strings in single quotes are turned into double-quoted ones
+func readList(path []byte, i int) (int, *tToken, error) {
+	list := []byte{'['}
+	l := len(path)
+	i = skipBlank(path, i+1)
+	if i < l && path[i] == ']' {
+		return i + 1, &tToken{Operand: &tOperand{Type: cOpArray, Str: append(list, ']')}}, nil
+	}
+	for i < l {
+		e, err := literalEnd(path, i)
+		if err != nil {
+			return i, nil, err
+		}
+		if len(list) > 1 {
+			list = append(list, ',')
+		}
+		list = appendLiteral(list, path[i:e])
+		if i = skipBlank(path, e); i == l {
+			break
+		}
+		if path[i] == ']' {
+			return i + 1, &tToken{Operand: &tOperand{Type: cOpArray, Str: append(list, ']')}}, nil
+		}
+		if path[i] != ',' {
+			return i, nil, errListSeparator
+		}
+		i = skipBlank(path, i+1)
+	}
+	return i, nil, errUnexpectedEOT
+}
+
+// skipBlank skips the whitespace within a jsonpath
+func skipBlank(path []byte, i int) int {
+	for i < len(path) && strings.IndexByte(pathSpace, path[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
 func readBool(path []byte, i int) (int, *tToken, error) {
 	s := i
 	l := len(path)
@@ -255,6 +376,60 @@ func readBool(path []byte, i int) (int, *tToken, error) {
 	return i, &tToken{Operand: &tOperand{Type: cOpBool, Bool: path[s] == 't'}}, nil
 }
 
+func readNull(path []byte, i int) (int, *tToken, error) {
+	if len(path)-i < 4 || string(path[i:i+4]) != "null" {
+		return i, nil, errInvalidNull
+	}
+	return i + 4, &tToken{Operand: &tOperand{Type: cOpNull}}, nil
+}
+
+// isFunction reports whether a function call like name(...) starts at i
+func isFunction(path []byte, i int) bool {
+	l := len(path)
+	s := i
+	for i < l && path[i] >= 'a' && path[i] <= 'z' {
+		i++
+	}
+	return i > s && i < l && path[i] == '('
+}
+
+var filterFunctions = [...]string{"type", "size"}
+
+func readFunction(path []byte, i int) (int, *tToken, error) {
+	l := len(path)
+	s := i
+	for path[i] != '(' {
+		i++
+	}
+	fn := path[s:i]
+	known := false
+	for _, name := range filterFunctions {
+		known = known || string(fn) == name
+	}
+	if !known {
+		return s, nil, errPathUnknownFunction
+	}
+	i, err := skipSpaces(path, i+1)
+	if err != nil {
+		return i, nil, err
+	}
+	if path[i] != '@' && path[i] != '$' {
+		return i, nil, errUnknownToken
+	}
+	nod, j, err := parsePath(path[i:], false)
+	if err != nil {
+		return i + j, nil, err
+	}
+	i += j
+	for i < l && path[i] == ' ' {
+		i++
+	}
+	if i == l || path[i] != ')' {
+		return i, nil, errUnexpectedEOT
+	}
+	return i + 1, &tToken{Operand: &tOperand{Type: cOpNone, Node: nod, Func: fn}}, nil
+}
+
 func readRegexp(path []byte, i int) (int, *tToken, error) {
 	l := len(path)
 	prev := byte(0)
@@ -269,10 +444,15 @@ func readRegexp(path []byte, i int) (int, *tToken, error) {
 	if i < l { // skip trailing '/'
 		i++
 	}
+	// flags: i (case-insensitive), m (multi-line), s (. matches \n), U (ungreedy)
 	flags = append(flags, '(', '?')
-	for i < l && len(flags) < 4 && (path[i] == 'i' || path[i] == 'm' || path[i] == 's' || path[i] == 'U') {
-		flags = append(flags, path[i])
-		i++
+	for ; i < l && isWordChar(path[i]); i++ {
+		if !bytein(path[i], []byte{'i', 'm', 's', 'U'}) {
+			return i, nil, errRegexpFlag
+		}
+		if bytes.IndexByte(flags, path[i]) < 0 {
+			flags = append(flags, path[i])
+		}
 	}
 	flags = append(flags, ')')
 	rex := ""
@@ -289,11 +469,11 @@ func readRegexp(path []byte, i int) (int, *tToken, error) {
 }
 
 // filterMatch
-func filterMatch(input []byte, toks []*tToken) (bool, error) {
+func filterMatch(q *tQuery, input []byte, toks []*tToken, pos tPosition) (bool, error) {
 	if len(toks) == 0 {
 		return false, errEmptyFilter
 	}
-	op, _, err := evalToken(input, toks)
+	op, _, err := evalToken(q, input, toks, pos)
 	if err != nil {
 		return false, err
 	}
@@ -304,48 +484,109 @@ func filterMatch(input []byte, toks []*tToken) (bool, error) {
 		return op.Bool, nil
 	case cOpNumber:
 		return op.Number > 0, nil
-	case cOpString:
+	case cOpString, cOpArray:
 		return len(op.Str) > 0, nil
 	default:
 		return false, nil
 	}
 }
 
-func evalToken(input []byte, toks []*tToken) (*tOperand, []*tToken, error) {
+func evalToken(q *tQuery, input []byte, toks []*tToken, pos tPosition) (*tOperand, []*tToken, error) {
 	if len(toks) == 0 {
 		return nil, toks, errNotEnoughArguments
 	}
 	tok := toks[0]
 	if tok.Operand != nil {
-		if tok.Operand.Node != nil {
-			val, err := getValue(input, tok.Operand.Node)
-			if err != nil {
-				// not found or other error
-				tok.Operand.Type = cOpNull
-				return tok.Operand, toks[1:], nil
-			}
-			return tok.Operand, toks[1:], decodeValue(val, tok.Operand)
-		}
-		return tok.Operand, toks[1:], nil
+		op, err := evalOperand(q, input, tok.Operand, pos)
+		return op, toks[1:], err
 	}
 	var (
 		err   error
 		left  *tOperand
 		right *tOperand
 	)
-	left, toks, err = evalToken(input, toks[1:])
+	left, toks, err = evalToken(q, input, toks[1:], pos)
 	if err != nil {
 		return nil, toks, err
 	}
-	right, toks, err = evalToken(input, toks)
+	if (tok.Operator == '&' || tok.Operator == '|') && (left.Type == cOpNull || (tok.Operator == '&' && !isTrue(left))) {
+		// the result is false whatever the right operand is, so it is not evaluated
+		return &tOperand{Type: cOpBool}, skipToken(toks), nil
+	}
+	if tok.Operator == '|' && isTrue(left) && toks[0].Operand == nil {
+		// the result is true whatever the right expression is, so it is not evaluated.
+		// Only a lone operand may refer to a missing field, which makes the result false
+		return &tOperand{Type: cOpBool, Bool: true}, skipToken(toks), nil
+	}
+	right, toks, err = evalToken(q, input, toks, pos)
 	if err != nil {
 		return nil, toks, err
 	}
 
-	op, err := execOperator(tok.Operator, left, right)
+	op, err := execOperator(tok.Operator, tok.Fold, left, right)
 	return op, toks, err
 }
 
+// evalOperand returns the value of the operand for the current element.
+// The operand is shared by every evaluation of the filter, so a computed value is returned in a copy.
+func evalOperand(q *tQuery, input []byte, op *tOperand, pos tPosition) (*tOperand, error) {
+	switch {
+	case op.Var == 'i':
+		return &tOperand{Type: cOpNumber, Number: float64(pos.index)}, nil
+	case op.Var == 'l':
+		return &tOperand{Type: cOpNumber, Number: float64(pos.length)}, nil
+	case op.Node == nil:
+		return op, nil
+	case len(op.Node.Key) == 1 && op.Node.Key[0] == '$':
+		return rootOperand(q, op), nil
+	}
+	res := *op
+	val, err := operandValue(q, input, op.Node)
+	if err != nil {
+		// not found or other error
+		res.Type = cOpNull
+		return &res, nil
+	}
+	return &res, resolveOperand(val, &res)
+}
+
+// operandValue returns the value referenced by jsonpath operand
+func operandValue(q *tQuery, input []byte, nod *tNode) ([]byte, error) {
+	if nod.Next == nil && nod.Type&cArrayType == 0 && len(nod.Key) == 1 && nod.Key[0] == '@' {
+		// lone @ is the current element itself, which may be a scalar
+		return input, nil
+	}
+	return getValue(q, input, nod)
+}
+
+// resolveOperand sets the operand to the (function of) value
+func resolveOperand(input []byte, op *tOperand) error {
+	if len(op.Func) > 0 {
+		return execFunction(input, op)
+	}
+	return decodeValue(input, op)
+}
+
+func execFunction(input []byte, op *tOperand) error {
+	switch string(op.Func) {
+	case "type":
+		op.Type = cOpString
+		op.Str = word(valueType(input))
+	case "size":
+		i, err := skipSpaces(input, 0)
+		if err != nil {
+			return err
+		}
+		e, err := skipValue(input, i)
+		if err != nil {
+			return err
+		}
+		op.Type = cOpNumber
+		op.Number = float64(e - i)
+	}
+	return nil
+}
+
 func decodeValue(input []byte, op *tOperand) error {
 	i, err := skipSpaces(input, 0)
 	if err != nil {
@@ -355,7 +596,11 @@ func decodeValue(input []byte, op *tOperand) error {
 	if err != nil {
 		return err
 	}
-	if bytein(input[i], []byte{'"', '\'', '{', '['}) {
+	if input[i] == '[' {
+		// array
+		op.Type = cOpArray
+		op.Str = input[i:e]
+	} else if bytein(input[i], []byte{'"', '\'', '{'}) {
 		// string
 		op.Type = cOpString
 		if input[i] == '"' || input[i] == '\'' { // exclude quotes
@@ -363,7 +608,7 @@ func decodeValue(input []byte, op *tOperand) error {
 			e--
 		}
 		op.Str = input[i:e]
-	} else if (input[i] >= '0' && input[i] <= '9') || input[i] == '-' || input[i] == '.' {
+	} else if (input[i] >= '0' && input[i] <= '9') || input[i] == '-' || input[i] == '.' || input[i] == '+' {
 		// number
 		f, err := strconv.ParseFloat(string(input[i:e]), 64)
 		if err != nil {
@@ -388,15 +633,15 @@ func decodeValue(input []byte, op *tOperand) error {
 	return nil
 }
 
-func execOperator(op byte, left *tOperand, right *tOperand) (*tOperand, error) {
+func execOperator(op byte, fold bool, left *tOperand, right *tOperand) (*tOperand, error) {
 	var res tOperand
 
 	if op == '+' || op == '-' || op == '*' || op == '/' {
 		// arithmetic
 		return opArithmetic(op, left, right)
-	} else if op == 'g' || op == 'l' || op == 'E' || op == 'N' || op == 'G' || op == 'L' || op == 'R' {
+	} else if op == 'g' || op == 'l' || op == 'E' || op == 'N' || op == 'G' || op == 'L' || op == 'R' || op == 'I' || op == 'O' {
 		// comparison
-		return opComparison(op, left, right)
+		return opComparison(op, fold, left, right)
 	} else if op == '&' || op == '|' {
 		// logic
 		return opLogic(op, left, right)
@@ -424,28 +669,97 @@ func opArithmetic(op byte, left *tOperand, right *tOperand) (*tOperand, error) {
 	return &res, nil
 }
 
-func opComparison(op byte, left *tOperand, right *tOperand) (*tOperand, error) {
+func opComparison(op byte, fold bool, left *tOperand, right *tOperand) (*tOperand, error) {
 	var res tOperand
 
 	res.Type = cOpBool
+	if op == 'O' {
+		// nin is the exact negation of in: an absent value is in no list but one containing null, so nin holds for it otherwise
+		in, err := opComparison('I', fold, left, right)
+		if err != nil {
+			return nil, err
+		}
+		res.Bool = !in.Bool
+		return &res, nil
+	}
+	if op == 'E' || op == 'N' {
+		// equality never fails: an absent value equals null, values of different types are not equal
+		if left.Type == cOpNull || right.Type == cOpNull || scalarType(left) != scalarType(right) {
+			res.Bool = (left.Type == right.Type) == (op == 'E')
+			return &res, nil
+		}
+	}
+	if op == 'I' {
+		// null is a value like any other: @.s in [null]
+		return opMembership(fold, left, right)
+	}
 	if left.Type == cOpNull || right.Type == cOpNull {
 		res.Bool = false
 		return &res, nil
 	}
+	ltype, rtype := scalarType(left), scalarType(right)
 	if op == 'R' {
-		if !(left.Type == cOpString && right.Type == cOpRegexp) {
+		if !(ltype == cOpString && right.Type == cOpRegexp) {
 			return nil, errInvalidRegexp
 		}
-	} else if left.Type != right.Type {
+	} else if ltype != rtype {
 		return nil, errOperandTypes
 	}
-	switch left.Type {
+	switch ltype {
 	case cOpBool:
 		return opComparisonBool(op, left, right)
 	case cOpNumber:
 		return opComparisonNumber(op, left, right)
 	case cOpString:
-		return opComparisonString(op, left, right)
+		return opComparisonString(op, fold, left, right)
+	}
+	return &res, nil
+}
+
+// scalarType returns the operand type for comparison: arrays are compared as strings
+func scalarType(op *tOperand) int {
+	if op.Type == cOpArray {
+		return cOpString
+	}
+	return op.Type
+}
+
+// opMembership checks if the left operand equals any element of the right (array) operand
+func opMembership(fold bool, left *tOperand, right *tOperand) (*tOperand, error) {
+	var res tOperand
+	res.Type = cOpBool
+	if right.Type != cOpArray {
+		return &res, nil
+	}
+	arr := right.Str
+	l := len(arr)
+	i, err := skipSpaces(arr, 1)
+	if err != nil {
+		return nil, err
+	}
+	for i < l && arr[i] != ']' {
+		e, err := skipValue(arr, i)
+		if err != nil {
+			return nil, err
+		}
+		var elem tOperand
+		if err = decodeValue(arr[i:e], &elem); err != nil {
+			return nil, err
+		}
+		if elem.Type == left.Type && left.Type != cOpArray {
+			eq, err := opComparison('E', fold, left, &elem)
+			if err != nil {
+				return nil, err
+			}
+			if eq.Bool {
+				res.Bool = true
+				return &res, nil
+			}
+		}
+		// skip spaces after value
+		if i, err = skipSpaces(arr, e); err != nil {
+			return nil, err
+		}
 	}
 	return &res, nil
 }
@@ -490,14 +804,14 @@ func opComparisonNumber(op byte, left *tOperand, right *tOperand) (*tOperand, er
 	return &res, nil
 }
 
-func opComparisonString(op byte, left *tOperand, right *tOperand) (*tOperand, error) {
+func opComparisonString(op byte, fold bool, left *tOperand, right *tOperand) (*tOperand, error) {
 	var res tOperand
 	res.Type = cOpBool
 	switch op {
 	case 'E':
-		res.Bool = compareSlices(left.Str, right.Str) == 0
+		res.Bool = equalStrings(left.Str, right.Str, fold)
 	case 'N':
-		res.Bool = compareSlices(left.Str, right.Str) != 0
+		res.Bool = !equalStrings(left.Str, right.Str, fold)
 	case 'R':
 		res.Bool = right.Regexp.MatchString(string(left.Str))
 	default:
@@ -513,30 +827,59 @@ func opLogic(op byte, left *tOperand, right *tOperand) (*tOperand, error) {
 		res.Bool = false
 		return &res, nil
 	}
-	l := false
-	r := false
-	switch left.Type {
-	case cOpBool:
-		l = left.Bool
-	case cOpNumber:
-		l = left.Number != 0
-	case cOpString:
-		l = len(left.Str) > 0
+	if op == '&' {
+		res.Bool = isTrue(left) && isTrue(right)
+	} else {
+		res.Bool = isTrue(left) || isTrue(right)
 	}
-	switch right.Type {
+	return &res, nil
+}
+
+// isTrue reports whether the operand counts as true in a logical expression, null (not found) being false
+func isTrue(op *tOperand) bool {
+	switch op.Type {
 	case cOpBool:
-		r = right.Bool
+		return op.Bool
 	case cOpNumber:
-		r = right.Number != 0
-	case cOpString:
-		r = len(right.Str) > 0
+		return op.Number != 0
+	case cOpString, cOpArray:
+		return len(op.Str) > 0
 	}
-	if op == '&' {
-		res.Bool = l && r
-	} else {
-		res.Bool = l || r
+	return false
+}
+
+// checkOperands returns the tokens following the expression at the head of toks, checking that every operator has got its operands
+func checkOperands(toks []*tToken) ([]*tToken, error) {
+	if len(toks) == 0 {
+		return toks, errNotEnoughArguments
 	}
-	return &res, nil
+	if toks[0].Operand != nil {
+		return toks[1:], nil
+	}
+	rest, err := checkOperands(toks[1:])
+	if err != nil {
+		return rest, err
+	}
+	return checkOperands(rest)
+}
+
+// skipToken returns the tokens following the expression at the head of toks
+func skipToken(toks []*tToken) []*tToken {
+	if len(toks) == 0 {
+		return toks
+	}
+	if toks[0].Operand != nil {
+		return toks[1:]
+	}
+	return skipToken(skipToken(toks[1:]))
+}
+
+// equalStrings compares the strings, ignoring case if fold is set
+func equalStrings(s1 []byte, s2 []byte, fold bool) bool {
+	if fold {
+		return bytes.EqualFold(s1, s2)
+	}
+	return compareSlices(s1, s2) == 0
 }
 
 func compareSlices(s1 []byte, s2 []byte) int {
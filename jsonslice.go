@@ -11,28 +11,88 @@ package jsonslice
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+// ErrPartialResult is returned along with the matches collected so far
+// when a deep scan or a wildcard hits malformed data and Options.RecoverPartial is set.
+// The error returned wraps it along with the cause, check it with errors.Is.
+var ErrPartialResult = errors.New("partial result: malformed data")
+
+// ErrBufferTooSmall is returned by GetInto along with the size required when the result does not fit into dst
+var ErrBufferTooSmall = errors.New("buffer too small")
+
+// ErrArrayElementNotFound is returned when nothing matches the jsonpath: the key or the element is missing
+var ErrArrayElementNotFound = errors.New(`specified array element not found`)
+
+// ErrFieldNotFound is returned when the field a jsonpath refers to is missing, e.g. by Document.Set or Rename
+var ErrFieldNotFound = errors.New(`field not found`)
+
+// PathError is a jsonpath syntax error: Err tells what is wrong, Pos is the position in Path where it is found.
+// Its text is that of Err followed by the position: "path: index bound missing at 4".
+type PathError struct {
+	Err  error
+	Pos  int
+	Path string
+}
+
+func (e *PathError) Error() string {
+	return e.Err.Error() + " at " + strconv.Itoa(e.Pos)
+}
+
+// Unwrap returns the underlying error
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
 var (
 	nodePool sync.Pool
+	pathPool sync.Pool // jsonpath buffers of GetInto
 
 	errPathEmpty,
 	errPathRootExpected,
 	errPathUnexpectedEnd,
+	errPathUnexpectedText,
 	errPathInvalidReference,
 	errPathUnknownFunction,
+	errPathFunctionArgument,
 	errPathIndexBoundMissing,
 	errPathKeyListTerminated,
+	errPathKeyListSeparator,
+	errPathKeyListKey,
 	errPathIndexNonsense,
-	errArrayElementNotFound,
-	errFieldNotFound,
+	errPathStepNonsense,
+	errPathFallbackValue,
+	errPathIndexOverflow,
+	errKeyListExpected,
+	errPathDeepScanTarget,
+	errPathMemberExpected,
+	errPathNotAllowed,
+	errOverlappingEdit,
+	errOffsetOutOfRange,
+	errScanLimit,
+	errFuncInvalid,
+	errFuncRegistered,
 	errArrayExpected,
+	errStringExpected,
+	errNumberExpected,
+	errSlicePointerExpected,
 	errColonExpected,
+	errInvalidCharacter,
+	errInvalidNumber,
+	errInvalidEscape,
+	errTrailingData,
 	errUnrecognizedValue,
 	errUnexpectedEnd,
+	errKeyExpected,
 	errObjectExpected,
 	errInvalidLengthUsage,
 	errObjectOrArrayExpected,
@@ -40,15 +100,22 @@ var (
 	errFunctionsNotSupported,
 	errTerminalNodeArray,
 	errSubslicingNotSupported,
+	errComputedValue,
 	errUnexpectedEOT,
+	errListSeparator,
 	errUnknownToken,
 	errUnexpectedStringEnd,
 	errInvalidBoolean,
+	errInvalidNull,
 	errEmptyFilter,
+	errDuplicateKey,
+	errFilterUnterminated,
 	errNotEnoughArguments,
+	errOperatorExpected,
 	errUnknownOperator,
 	errInvalidArithmetic,
 	errInvalidRegexp,
+	errRegexpFlag,
 	errOperandTypes,
 	errInvalidOperatorStrings error
 )
@@ -58,47 +125,83 @@ func init() {
 		New: func() interface{} {
 			return &tNode{
 				Keys:  make([]word, 0),
-				Elems: make([]int, 0),
+				Elems: make([]tSlice, 0),
 			}
 		},
 	}
+	pathPool = sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, 0, 64)
+			return &buf
+		},
+	}
 
 	errPathEmpty = errors.New("path: empty")
 	errPathRootExpected = errors.New("path: $ expected")
 	errPathUnexpectedEnd = errors.New("path: unexpected end of path")
+	errPathUnexpectedText = errors.New("path: unexpected text")
 	errPathInvalidReference = errors.New("path: invalid element reference")
 	errPathUnknownFunction = errors.New("path: unknown function")
+	errPathFunctionArgument = errors.New("path: invalid function argument")
 	errPathIndexBoundMissing = errors.New("path: index bound missing")
 	errPathKeyListTerminated = errors.New("path: key list terminated unexpectedly")
+	errPathKeyListSeparator = errors.New("path: ',' or ']' expected in key list")
+	errPathKeyListKey = errors.New("path: quoted key expected in key list")
 	errPathIndexNonsense = errors.New("path: 0 as a second bound does not make sense")
-	errArrayElementNotFound = errors.New(`specified array element not found`)
-	errFieldNotFound = errors.New(`field not found`)
+	errPathStepNonsense = errors.New("path: 0 as a slice step does not make sense")
+	errPathFallbackValue = errors.New("path: invalid fallback value")
+	errPathIndexOverflow = errors.New("path: index out of range")
+	errKeyListExpected = errors.New("path: key list expected")
+	errPathDeepScanTarget = errors.New("path: deep scan target expected")
+	errPathMemberExpected = errors.New("path: object member expected")
+	errPathNotAllowed = errors.New("path: not allowed")
+	errOverlappingEdit = errors.New("edit overlaps a pending one")
+	errOffsetOutOfRange = errors.New("offset out of range")
+	errScanLimit = errors.New("scan limit exceeded")
+	errFuncInvalid = errors.New("function name or handler invalid")
+	errFuncRegistered = errors.New("function already exists")
 	errColonExpected = errors.New("':' expected")
+	errInvalidCharacter = errors.New("invalid character")
+	errInvalidNumber = errors.New("invalid number")
+	errInvalidEscape = errors.New("invalid escape sequence")
+	errTrailingData = errors.New("unexpected data after the value")
 	errUnrecognizedValue = errors.New("unrecognized value: true, false or null expected")
 	errUnexpectedEnd = errors.New("unexpected end of input")
+	errKeyExpected = errors.New("object key expected")
 	errObjectExpected = errors.New("object expected")
 	errArrayExpected = errors.New("array expected")
-	errInvalidLengthUsage = errors.New("length() is only applicable to array or string")
+	errStringExpected = errors.New("string expected")
+	errNumberExpected = errors.New("number expected")
+	errSlicePointerExpected = errors.New("pointer to a slice expected")
+	errInvalidLengthUsage = errors.New("length() is only applicable to array, object or string")
 	errObjectOrArrayExpected = errors.New("object or array expected")
 	errWildcardsNotSupported = errors.New("wildcards are not supported in GetArrayElements")
 	errFunctionsNotSupported = errors.New("functions are not supported in GetArrayElements")
 	errTerminalNodeArray = errors.New("terminal node must be an array")
 	errSubslicingNotSupported = errors.New("sub-slicing is not supported in GetArrayElements")
+	errComputedValue = errors.New("a function result has no position in the input")
 	errUnexpectedEOT = errors.New("unexpected end of token")
+	errListSeparator = errors.New("',' or ']' expected in list")
 	errUnknownToken = errors.New("unknown token")
 	errUnexpectedStringEnd = errors.New("unexpected end of string")
 	errInvalidBoolean = errors.New("invalid boolean value")
+	errInvalidNull = errors.New("invalid null value")
 	errEmptyFilter = errors.New("empty filter")
+	errDuplicateKey = errors.New("duplicate key")
+	errFilterUnterminated = errors.New("')' expected in filter")
 	errNotEnoughArguments = errors.New("not enough arguments")
+	errOperatorExpected = errors.New("operator expected")
 	errUnknownOperator = errors.New("unknown operator")
 	errInvalidArithmetic = errors.New("invalid operands for arithmetic operator")
 	errInvalidRegexp = errors.New("invalid operands for regexp match")
+	errRegexpFlag = errors.New("unknown regexp flag: i, m, s or U expected")
 	errOperandTypes = errors.New("operand types do not match")
 	errInvalidOperatorStrings = errors.New("operator is not applicable to strings")
 }
 
 func getEmptyNode() *tNode {
 	nod := nodePool.Get().(*tNode)
+	nod.Arg = nil
 	nod.Elems = nod.Elems[:0]
 	nod.Exists = false
 	nod.Filter = nil
@@ -106,60 +209,738 @@ func getEmptyNode() *tNode {
 	nod.Keys = nod.Keys[:0]
 	nod.Left = 0
 	nod.Next = nil
+	nod.Opts = nil
 	nod.Right = 0
+	nod.Step = 0
 	nod.Type = 0
 	return nod
 }
 
+// Options modify the way jsonpath is parsed and evaluated (see GetWithOptions).
+// A zero value means the default behaviour.
+type Options struct {
+	// RootToken replaces '$' as the leading root token of jsonpath.
+	// Root references inside filters still use '$'.
+	RootToken byte
+	// WithIndices annotates the elements selected by a terminal filter with their positions in the array:
+	// [{"index":2,"value":...},{"index":5,"value":...}]
+	WithIndices bool
+	// DuplicateKey chooses the value of a key occurring more than once in an object
+	DuplicateKey DuplicateKeyPolicy
+	// UnwrapSingle returns the element itself instead of a one-element array
+	// when an aggregating jsonpath (wildcard, filter, slice, key list, deep scan) matches exactly one element.
+	// Note that a single matched array can no longer be told apart from several matched elements.
+	UnwrapSingle bool
+	// MaxScanDepth limits the number of levels a deep scan ($..key) descends, 0 means no limit.
+	// Each object value or array element is one level down, so 1 only matches at the level the scan starts at.
+	MaxScanDepth int
+	// WithParents annotates the elements matched by a deep scan with the key or index of the value they were found in:
+	// [{"parent":"bicycle","value":...},{"parent":0,"value":...}]. The parent of a match at the starting level is null.
+	WithParents bool
+	// CaseInsensitiveValues makes string comparisons in filters (==, !=, in) ignore case
+	CaseInsensitiveValues bool
+	// NormalizeStrings re-escapes the strings of the result (object keys included) in the canonical form:
+	// the shortest escape sequences, lowercase \u hex, non-ASCII characters as is.
+	// Logically equal results are then equal byte-wise.
+	NormalizeStrings bool
+	// NormalizeNumbers rewrites the numbers of the result in the canonical form:
+	// 1.0 is 1, 1e2 is 100, 007 is 7, the exponent form is only used below 1e-6 and from 1e21 on.
+	NormalizeNumbers bool
+	// SortResults sorts the elements matched by an aggregating jsonpath by their canonical byte form
+	// instead of emitting them in document order, so equivalent inputs with keys in a different order give the same result.
+	// The elements themselves are emitted as is.
+	SortResults bool
+	// KeyListAsObject returns the values of a terminal key list as an object of the keys found instead of an array:
+	// $['a','b'] gives {"a":1,"b":2}, $['a'] gives {"a":1}. The keys are those of the document, missing keys are omitted.
+	KeyListAsObject bool
+	// ImplicitRoot accepts a jsonpath without the leading root token, the first step then being a top-level key or index:
+	// store.book[0] is $.store.book[0], [0].id is $[0].id
+	ImplicitRoot bool
+	// MaxBytesScanned fails a query with an error once it has scanned more than that many bytes of input in total, 0 means no limit.
+	// The bytes are counted each time they are scanned, so a deep scan counts the nested values once per level.
+	MaxBytesScanned int
+	// RecoverPartial makes a deep scan ($..key) or a wildcard ($.*) hitting malformed data (a truncated document, for one)
+	// stop at the last complete value and return the matches found so far along with ErrPartialResult.
+	RecoverPartial bool
+	// UnwrapEnvelopes replaces a result being an object of a single key with the value of that key,
+	// repeatedly up to that many levels, stopping at the first value other than a single-key object:
+	// {"data":{"result":{"id":1,"n":2}}} gives {"id":1,"n":2} for 2 and more. 0 means no unwrapping.
+	UnwrapEnvelopes int
+}
+
 // Get returns a part of input, matching jsonpath.
 // In terms of allocations there are two cases of retreiving data from the input:
 // 1. (simple case) the result is a simple subslice of a source input.
 // 2. the result is a merge of several non-contiguous parts of input. More allocations are needed.
 func Get(input []byte, path string) ([]byte, error) {
+	return GetWithOptions(input, path, nil)
+}
+
+// GetWithOptions is the same as Get, with the behaviour modified by opts (nil means defaults).
+func GetWithOptions(input []byte, path string, opts *Options) ([]byte, error) {
 
 	if len(path) == 0 {
 		return nil, errPathEmpty
 	}
 
-	if len(path) == 1 && path[0] == '$' {
-		return input, nil
+	if strings.Contains(path, "??") {
+		if alts := fallbacks(path); len(alts) > 1 {
+			return getFallback(input, path, alts, opts)
+		}
 	}
 
-	if path[0] != '$' {
-		return nil, errPathRootExpected
+	if trimmed := strings.Trim(path, pathSpace); len(trimmed) == 1 && trimmed[0] == rootToken(opts) {
+		if opts != nil && opts.UnwrapEnvelopes > 0 {
+			return unwrapEnvelopes(input, opts)
+		}
+		return normalizeResult(input, opts)
 	}
 
-	node, i, err := parsePath([]byte(path))
+	node, err := compilePath(path, opts)
 	if err != nil {
-		repool(node)
-		return nil, errors.New(err.Error() + " at " + strconv.Itoa(i))
+		return nil, err
 	}
 
-	n := node
-	for {
-		n = n.Next
-		if n == nil {
+	result, err := evaluate(input, node, opts)
+	repool(node)
+	return result, err
+}
+
+// evaluate applies the compiled jsonpath to input, the result is then modified by opts
+func evaluate(input []byte, node *tNode, opts *Options) ([]byte, error) {
+
+	q := newQuery(input)
+	if opts != nil && opts.MaxBytesScanned > 0 {
+		q.budget = &tBudget{left: opts.MaxBytesScanned}
+	}
+
+	result, err := getValue(q, input, node)
+	partial := err
+	if !errors.Is(err, ErrPartialResult) {
+		partial = nil
+	}
+	if partial != nil {
+		err = nil
+	}
+	if err == nil && q.budget != nil && q.budget.left < 0 {
+		err = errScanLimit // reached in a value lacking the sub-path
+	}
+	if err == nil && opts != nil && opts.SortResults && aggregates(node) {
+		result, err = sortElements(result)
+	}
+	if err == nil && opts != nil && opts.UnwrapSingle && aggregates(node) {
+		result = unwrapSingle(result)
+	}
+	if err == nil && opts != nil && opts.UnwrapEnvelopes > 0 {
+		result, err = unwrapEnvelopes(result, opts)
+	} else if err == nil {
+		result, err = normalizeResult(result, opts)
+	}
+	if err == nil && partial != nil {
+		err = partial
+	}
+	return result, err
+}
+
+// normalizeResult applies the normalizations of the options to the result
+func normalizeResult(result []byte, opts *Options) ([]byte, error) {
+	var err error
+	if opts != nil && opts.NormalizeStrings {
+		if result, err = normalizeStrings(result); err != nil {
+			return nil, err
+		}
+	}
+	if opts != nil && opts.NormalizeNumbers {
+		return normalizeNumbers(result)
+	}
+	return result, nil
+}
+
+// isWildcard reports whether the node key is the * wildcard (a quoted '*' is a key like any other)
+func isWildcard(nod *tNode) bool {
+	return len(nod.Key) == 1 && nod.Key[0] == '*' && nod.Type&cQuoted == 0
+}
+
+// aggregates reports whether the result of the node chain is an array of matched elements
+func aggregates(node *tNode) bool {
+	agg := false
+	for nod := node; nod != nil; nod = nod.Next {
+		if nod.Type&cSubject > 0 {
+			// the function is applied to every value matched so far or by a wildcard,
+			// but to the selection of a slice or a key list as a whole
+			return agg || nod.Type&cGlob > 0 || isWildcard(nod)
+		}
+		if nod.Type&(cAgg|cDeep|cGlob) > 0 || (len(nod.Keys) > 0 && !keyListAsObject(nod)) || isWildcard(nod) {
+			agg = true
+		}
+	}
+	return agg
+}
+
+// unwrapSingle returns the only element of an array, or the array as is
+func unwrapSingle(result []byte) []byte {
+	if len(result) == 0 || result[0] != '[' {
+		return result
+	}
+	i, err := skipSpaces(result, 1)
+	if err != nil || result[i] == ']' {
+		return result
+	}
+	e, err := skipValue(result, i)
+	if err != nil {
+		return result
+	}
+	if j, err := skipSpaces(result, e); err != nil || result[j] != ']' {
+		return result
+	}
+	return result[i:e]
+}
+
+// unwrapEnvelopes replaces the result with the value of its only key up to opts.UnwrapEnvelopes times, then normalizes it
+func unwrapEnvelopes(result []byte, opts *Options) ([]byte, error) {
+	for depth := 0; depth < opts.UnwrapEnvelopes; depth++ {
+		i, err := skipSpaces(result, 0)
+		if err != nil || result[i] != '{' {
+			break // nothing matched or not an object
+		}
+		keys, vals, err := objectMembers(result[i:])
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) != 1 {
 			break
 		}
-		if n.Filter != nil {
-			for _, tok := range n.Filter.toks {
-				if tok.Operand != nil && tok.Operand.Node != nil && len(tok.Operand.Node.Key) == 1 && tok.Operand.Node.Key[0] == '$' {
-					val, err := getValue(input, tok.Operand.Node)
-					if err != nil {
-						// not found or other error
-						tok.Operand.Type = cOpNull
-					}
-					decodeValue(val, tok.Operand)
-					tok.Operand.Node = nil
-				}
+		result = vals[0]
+	}
+	return normalizeResult(result, opts)
+}
+
+// sortElements sorts the elements of an array by their canonical form, see appendCanonicalValue
+func sortElements(result []byte) ([]byte, error) {
+	if len(result) == 0 || result[0] != '[' {
+		return result, nil
+	}
+	spans, err := arrayScan(result)
+	if err != nil {
+		return nil, err
+	}
+	type keyed struct {
+		elem []byte
+		key  []byte
+	}
+	sorted := make([]keyed, len(spans))
+	for i, span := range spans {
+		elem := result[span.start:span.end]
+		key, err := appendCanonicalValue(nil, elem)
+		if err != nil {
+			return nil, err
+		}
+		sorted[i] = keyed{elem, key}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].key, sorted[j].key) < 0 })
+	elems := make([][]byte, len(sorted))
+	for i := range sorted {
+		elems[i] = sorted[i].elem
+	}
+	return mergeElements(elems), nil
+}
+
+// compactValue returns the value without the whitespace outside of strings
+func compactValue(value []byte) []byte {
+	res := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		switch ch := value[i]; ch {
+		case ' ', '\t', '\r', '\n':
+		case '"':
+			e, err := skipString(value, i)
+			if err != nil {
+				return append(res, value[i:]...)
 			}
+			res = append(res, value[i:e]...)
+			i = e - 1
+		default:
+			res = append(res, ch)
 		}
 	}
+	return res
+}
 
-	result, err := getValue(input, node)
+// GetInto writes the part of input matching jsonpath into dst and returns the number of bytes written.
+// If dst is too small nothing is written: the size required is returned along with ErrBufferTooSmall,
+// so the call may be repeated with a large enough buffer.
+// In the simple case (the result is a subslice of input) GetInto does not allocate.
+func GetInto(dst []byte, input []byte, path string) (int, error) {
+	buf := pathPool.Get().(*[]byte)
+	bpath := append((*buf)[:0], path...)
 
-	repool(node)
-	return result, err
+	node, err := compileBytes(bpath, path, nil)
+	var result []byte
+	if err == nil {
+		q := newQuery(input)
+		result, err = getValue(q, input, node)
+		repool(node)
+	}
+
+	*buf = bpath
+	pathPool.Put(buf)
+	if err != nil {
+		return 0, err
+	}
+	if len(result) > len(dst) {
+		return len(result), ErrBufferTooSmall
+	}
+	return copy(dst, result), nil
+}
+
+// compilePath checks and parses jsonpath, the parse error is supplemented with its position
+func compilePath(path string, opts *Options) (*tNode, error) {
+	return compileBytes([]byte(path), path, opts)
+}
+
+// compileBytes is compilePath for a jsonpath the nodes may refer to until repooled.
+// Leading and trailing whitespace is ignored, error positions still refer to the original jsonpath.
+func compileBytes(bpath []byte, path string, opts *Options) (*tNode, error) {
+
+	trimmed := bytes.TrimLeft(bpath, pathSpace)
+	lead := len(bpath) - len(trimmed)
+	bpath = bytes.TrimRight(trimmed, pathSpace)
+	if len(bpath) == 0 {
+		return nil, errPathEmpty
+	}
+
+	root := rootToken(opts)
+	if bpath[0] != root {
+		if opts == nil || !opts.ImplicitRoot {
+			return nil, errPathRootExpected
+		}
+		// a.b => $.a.b, [0] => $[0]
+		prefix := "$."
+		if bpath[0] == '.' || bpath[0] == '[' {
+			prefix = "$"
+		}
+		bpath = append([]byte(prefix), bpath...)
+		lead -= len(prefix)
+	}
+
+	bpath[0] = '$' // custom root token
+	node, i, err := parsePath(bpath, true)
+	if err == nil && i < len(bpath) {
+		// $.a xyz: reported at the text left
+		i = len(bpath) - len(bytes.TrimLeft(bpath[i:], pathSpace))
+		err = errPathUnexpectedText
+	}
+	if err != nil {
+		repool(node)
+		if lead+i < 0 {
+			i = -lead // within the implicit root
+		}
+		return nil, &PathError{Err: err, Pos: lead + i, Path: path}
+	}
+	if opts != nil {
+		setOptions(node, opts)
+	}
+	return node, nil
+}
+
+// setOptions propagates options to every node of the chain, including filter operands
+func setOptions(node *tNode, opts *Options) {
+	for n := node; n != nil; n = n.Next {
+		n.Opts = opts
+		if n.Filter == nil {
+			continue
+		}
+		for _, tok := range n.Filter.toks {
+			tok.Fold = opts.CaseInsensitiveValues
+			if tok.Operand != nil && tok.Operand.Node != nil {
+				setOptions(tok.Operand.Node, opts)
+			}
+		}
+	}
+}
+
+// DuplicateKeyPolicy tells which value of a duplicate object key is used
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateKeyFirst uses the first occurrence of the key (default)
+	DuplicateKeyFirst DuplicateKeyPolicy = iota
+	// DuplicateKeyLast uses the last occurrence of the key, the whole object is scanned
+	DuplicateKeyLast
+	// DuplicateKeyError fails with an error if the key occurs more than once, the whole object is scanned
+	DuplicateKeyError
+)
+
+// rootToken returns the root token of jsonpath
+func rootToken(opts *Options) byte {
+	if opts != nil && opts.RootToken != 0 {
+		return opts.RootToken
+	}
+	return '$'
+}
+
+// GetWithMeta returns the part of input matching jsonpath along with its JSON type:
+// object, array, string, number, boolean or null. The byte length is len(value).
+func GetWithMeta(input []byte, path string) ([]byte, string, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return nil, "", err
+	}
+	return value, valueType(value), nil
+}
+
+// GetArrayFilterFunc returns the elements of an array matching jsonpath for which pred returns true.
+// It is a filter expression written in Go: an error returned by pred stops the scan and is returned as is.
+func GetArrayFilterFunc(input []byte, path string, pred func(element []byte) (bool, error)) ([]byte, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 || value[0] != '[' {
+		return nil, errArrayExpected
+	}
+	i, err := skipSpaces(value, 1)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := matchElements(value, i, pred, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mergeElements(elems), nil
+}
+
+// GetEscaped returns the part of input matching jsonpath as a json string (quoted and escaped),
+// ready to be embedded into another document: {"a":1} becomes "{\"a\":1}"
+func GetEscaped(input []byte, path string) ([]byte, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return nil, err
+	}
+	return appendString(make([]byte, 0, len(value)+2), string(value)), nil
+}
+
+// GetConcat returns the contents of all the string values matching jsonpath joined together as a single json string:
+// "ab" for ["a","b"]. The escape sequences are decoded and the result is escaped in the canonical form.
+// Matching a value other than a string is an error.
+func GetConcat(input []byte, path string) ([]byte, error) {
+
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer repool(node)
+
+	q := newQuery(input)
+
+	elems, err := getElements(q, input, node, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := []byte{'"'}
+	for _, elem := range elems {
+		if elem[0] != '"' {
+			return nil, errStringExpected
+		}
+		result = appendCanonical(result, elem[1:len(elem)-1])
+	}
+	return append(result, '"'), nil
+}
+
+// GetTime parses the string value matching jsonpath as a timestamp.
+// The layout is time.RFC3339 unless specified.
+func GetTime(input []byte, path string, layout ...string) (time.Time, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(value) < 2 || value[0] != '"' {
+		return time.Time{}, errStringExpected
+	}
+	l := time.RFC3339
+	if len(layout) > 0 {
+		l = layout[0]
+	}
+	return time.Parse(l, string(value[1:len(value)-1]))
+}
+
+// GetJSONNumber returns the number value matching jsonpath as json.Number, exactly as written in input,
+// so that it can be parsed without losing precision.
+func GetJSONNumber(input []byte, path string) (json.Number, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return "", err
+	}
+	if len(value) == 0 || (value[0] != '-' && (value[0] < '0' || value[0] > '9')) {
+		return "", errNumberExpected
+	}
+	if e, err := validNumber(value, 0); err != nil || e != len(value) {
+		return "", errInvalidNumber
+	}
+	return json.Number(value), nil
+}
+
+// GetIndexOr returns the element at index (negative counts from the end) of the array matching jsonpath,
+// or def if the array is too short.
+func GetIndexOr(input []byte, path string, index int, def []byte) ([]byte, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 || value[0] != '[' {
+		return nil, errArrayExpected
+	}
+	elem, err := sliceArray(newQuery(value), value, &tNode{Type: cArrayType, Left: index})
+	if isNotFound(err) {
+		return def, nil
+	}
+	return elem, err
+}
+
+// GetHeadTail returns the first head and the last tail elements of the array matching jsonpath merged into one array.
+// The elements are not repeated if the array is shorter than head+tail.
+func GetHeadTail(input []byte, path string, head, tail int) ([]byte, error) {
+	elems, err := arrayElements(input, path)
+	if err != nil {
+		return nil, err
+	}
+	if head < 0 {
+		head = 0
+	}
+	if tail < 0 {
+		tail = 0
+	}
+	if head < len(elems) && tail < len(elems)-head {
+		elems = append(elems[:head:head], elems[len(elems)-tail:]...)
+	}
+	return mergeElements(elems), nil
+}
+
+// GetUnwrapped is Get stripping the single-key envelopes off the result: {"data":{"result":{...}}} gives {...}.
+// Up to 8 levels are unwrapped, see Options.UnwrapEnvelopes for another limit.
+func GetUnwrapped(input []byte, path string) ([]byte, error) {
+	return GetWithOptions(input, path, &Options{UnwrapEnvelopes: 8})
+}
+
+// GetManyMap returns a json object mapping each of the names to the value matching its jsonpath,
+// or null if there is no match. The names appear in lexical order.
+func GetManyMap(input []byte, names map[string]string) ([]byte, error) {
+	keys := make([]string, 0, len(names))
+	for name := range names {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	paths := make([]string, len(keys))
+	for i, name := range keys {
+		paths[i] = names[name]
+	}
+	values, errs := GetMany(input, paths)
+
+	result := []byte{'{'}
+	for i, name := range keys {
+		value, err := values[i], errs[i]
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+		if err != nil {
+			value = []byte("null")
+		}
+		if i > 0 {
+			result = append(result, ',')
+		}
+		result = append(appendString(result, name), ':')
+		result = append(result, value...)
+	}
+	return append(result, '}'), nil
+}
+
+// appendString appends s as a json string
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		dst = appendChar(dst, s[i])
+	}
+	return append(dst, '"')
+}
+
+// appendChar appends a byte of a json string, escaped in the shortest form if needed
+func appendChar(dst []byte, ch byte) []byte {
+	const hex = "0123456789abcdef"
+	switch {
+	case ch == '"' || ch == '\\':
+		return append(dst, '\\', ch)
+	case ch == '\b':
+		return append(dst, '\\', 'b')
+	case ch == '\f':
+		return append(dst, '\\', 'f')
+	case ch == '\n':
+		return append(dst, '\\', 'n')
+	case ch == '\r':
+		return append(dst, '\\', 'r')
+	case ch == '\t':
+		return append(dst, '\\', 't')
+	case ch < 0x20:
+		return append(dst, '\\', 'u', '0', '0', hex[ch>>4], hex[ch&0xF])
+	}
+	return append(dst, ch)
+}
+
+// GetFirst tries paths in order and returns the first value found along with the path that matched.
+// Only "not found" errors fall through to the next path, any other error is returned immediately.
+func GetFirst(input []byte, paths ...string) ([]byte, string, error) {
+	err := errPathEmpty
+	for _, path := range paths {
+		var result []byte
+		result, err = Get(input, path)
+		if err == nil {
+			return result, path, nil
+		}
+		if !isNotFound(err) {
+			return nil, "", err
+		}
+	}
+	return nil, "", err
+}
+
+// Lookup is Get telling a missing value from a failure, like a map access does.
+// found is false with a nil error if jsonpath matches nothing, a value of another type along the way included:
+// $.a.b is not found in {"a":1}, $.a[?(@.x)] is not found if no element matches.
+// err is only set for an invalid jsonpath or malformed input.
+func Lookup(input []byte, path string) (value []byte, found bool, err error) {
+	value, err = Get(input, path)
+	if isNotFound(err) || isTypeMismatch(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(value) == 0 {
+		return nil, false, nil
+	}
+	if isEmptyArray(value) {
+		// an empty array value is found, an empty set of matches is not
+		node, err := compilePath(path, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		agg := aggregates(node)
+		repool(node)
+		if agg {
+			return nil, false, nil
+		}
+	}
+	return value, true, nil
+}
+
+// isEmptyArray reports whether the value is an array without elements
+func isEmptyArray(input []byte) bool {
+	i, err := skipSpaces(input, 0)
+	if err != nil || input[i] != '[' {
+		return false
+	}
+	i, err = skipSpaces(input, i+1)
+	return err == nil && input[i] == ']'
+}
+
+// isTypeMismatch reports whether the error means the value is not of the type jsonpath expects
+func isTypeMismatch(err error) bool {
+	return err == errObjectExpected || err == errArrayExpected || err == errObjectOrArrayExpected
+}
+
+// GetMatchingKeys returns the keys of a key list (like $.obj['a','b','c']) present in the object.
+// The keys are returned in the order of the key list, as spelled in jsonpath.
+func GetMatchingKeys(input []byte, path string) ([]string, error) {
+
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer repool(node)
+
+	// split the chain into parent object and key list
+	parent := node
+	for parent.Next != nil && parent.Next.Next != nil {
+		parent = parent.Next
+	}
+	keys := parent.Next
+	if keys == nil || keys.Type&(cArrayType|cFunction|cDeep|cGlob) > 0 || isWildcard(keys) {
+		return nil, errKeyListExpected
+	}
+	parentType := parent.Type
+	parent.Type = (parent.Type | cIsTerminal) & (^cSubject)
+	parent.Next = nil
+
+	q := newQuery(input)
+	obj, err := getValue(q, input, node)
+
+	parent.Next = keys
+	parent.Type = parentType
+	if err != nil {
+		return nil, err
+	}
+	if len(obj) == 0 || obj[0] != '{' {
+		return nil, errObjectExpected
+	}
+
+	elems := make([][]byte, len(keys.Keys))
+	value, err := seekKey(q, obj, keys, elems, nil)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]string, 0, len(keys.Keys))
+	if len(keys.Keys) == 0 {
+		if value != nil {
+			found = append(found, string(keys.Key))
+		}
+		return found, nil
+	}
+	for i, key := range keys.Keys {
+		if len(elems[i]) > 0 {
+			found = append(found, string(key))
+		}
+	}
+	return found, nil
+}
+
+// isNotFound reports whether err means that the path does not exist in the input
+func isNotFound(err error) bool {
+	return err == ErrArrayElementNotFound || err == ErrFieldNotFound
+}
+
+// tQuery is the state of a single evaluation. The nodes themselves are never modified,
+// so a compiled jsonpath may be evaluated by several goroutines at once.
+type tQuery struct {
+	root   []byte                  // the input $ refers to
+	roots  map[*tOperand]*tOperand // root ($) references in filters resolved so far
+	budget *tBudget                // nil means no limit
+	found  int                     // the matches counted so far
+	limit  int                     // the query stops once limit matches are counted, 0 means no limit (see GetNthMatch)
+	emit   func([]byte) bool       // receives the counted matches as they are found, false stops the query (see GetChan)
+	done   bool
+}
+
+func newQuery(input []byte) *tQuery {
+	return &tQuery{root: input}
+}
+
+// rootOperand returns the value of a root ($) reference in a filter, evaluated once per query
+func rootOperand(q *tQuery, op *tOperand) *tOperand {
+	if res, ok := q.roots[op]; ok {
+		return res
+	}
+	res := *op
+	val, err := getValue(q, q.root, op.Node)
+	if err != nil {
+		// not found or other error
+		res.Type = cOpNull
+	} else {
+		resolveOperand(val, &res)
+	}
+	if q.roots == nil {
+		q.roots = make(map[*tOperand]*tOperand)
+	}
+	q.roots[op] = &res
+	return &res
 }
 
 const (
@@ -170,20 +951,120 @@ const (
 	cSubject     = 1 << iota // function subject
 	cAgg         = 1 << iota // aggregating
 	cDeep        = 1 << iota // deepscan
+	cGlob        = 1 << iota // key pattern
+	cClamped     = 1 << iota // slice bounds are clamped to the array length (deep scan target)
+	cQuoted      = 1 << iota // bracket-notated key: ['*'] is the key itself, not a wildcard
 )
 
 type word []byte
 
+// tSlice is a member of an index list: a single index (Left) or a slice [Left:Right)
+type tSlice struct {
+	Left   int
+	Right  int
+	Step   int // every Step-th element of a slice, 0 means 1
+	Ranged bool
+}
+
 type tNode struct {
 	Key    word
 	Keys   []word
-	Type   int // properties
-	Left   int // >=0 index from the start, <0 backward index from the end
-	Right  int // 0 till the end inclusive, >0 to index exclusive, <0 backward index from the end exclusive
-	Elems  []int
+	Type   int      // properties
+	Left   int      // >=0 index from the start, <0 backward index from the end
+	Right  int      // 0 till the end inclusive, >0 to index exclusive, <0 backward index from the end exclusive
+	Step   int      // every Step-th element of a slice, 0 means 1
+	Elems  []tSlice // index list [1,3:5,-1]
 	Next   *tNode
 	Filter *tFilter
 	Exists bool
+	Opts   *Options
+	Arg    word // function argument as written
+}
+
+// tBudget is the number of input bytes a query may still scan (see Options.MaxBytesScanned)
+type tBudget struct {
+	left int
+}
+
+// tCollect tells how an evaluation collects the matches of the node chain
+type tCollect int
+
+const (
+	cMerged  tCollect = iota // into the single value Get returns, the matches of an aggregating step merged into an array
+	cApart                   // apart from each other, each one a subslice of input unless computed by a function
+	cCounted                 // apart and counted by the query, which may stop early (see tQuery)
+)
+
+// tMatches are the matches collected by an evaluation: a single value if merged, the elements otherwise
+type tMatches struct {
+	c     tCollect
+	value []byte
+	elems [][]byte
+}
+
+// add collects the matches found, which are emitted one by one instead if the query counts them that way
+func (m *tMatches) add(q *tQuery, found ...[]byte) {
+	switch {
+	case m.c == cMerged:
+		m.value = found[0]
+		return
+	case m.c == cCounted:
+		q.found += len(found)
+		if q.emit != nil {
+			for _, elem := range found {
+				if !q.done && !q.emit(elem) {
+					q.done = true
+				}
+			}
+			return
+		}
+	}
+	m.elems = append(m.elems, found...)
+}
+
+// appendTo appends the matches collected to found, a merged value unless it is empty
+func (m *tMatches) appendTo(found [][]byte) [][]byte {
+	if m.c != cMerged {
+		return append(found, m.elems...)
+	}
+	if len(m.value) == 0 {
+		return found
+	}
+	return append(found, m.value)
+}
+
+// gather collects the matches of an aggregating step: merged into an array, or apart as they are
+func (m *tMatches) gather(found [][]byte) {
+	if m.c == cMerged {
+		m.value = mergeElements(found)
+	} else {
+		m.elems = append(m.elems, found...)
+	}
+}
+
+// partial keeps the matches of an aggregating step found so far if the options allow recovering from err
+func (m *tMatches) partial(nod *tNode, found [][]byte, err error) error {
+	if err = recoverPartial(nod, err); errors.Is(err, ErrPartialResult) {
+		m.gather(found)
+	}
+	return err
+}
+
+// enough reports whether the query has counted all the matches it needs
+func (m *tMatches) enough(q *tQuery) bool {
+	return m.c == cCounted && (q.done || (q.limit > 0 && q.found >= q.limit))
+}
+
+// scanned charges n scanned bytes to the query, failing once the budget is exceeded
+func scanned(q *tQuery, n int) error {
+	if q.budget == nil {
+		return nil
+	}
+	q.budget.left -= n
+	if q.budget.left < 0 {
+		return errScanLimit
+	}
+	return nil
 }
 
 // returns true if b matches one of the elements of seq
@@ -198,8 +1079,9 @@ func bytein(b byte, seq []byte) bool {
 
 var keyTerminator = []byte{' ', '\t', '.', '[', '(', ')', ']', '<', '=', '>', '+', '-', '*', '/', '&', '|'}
 
-// parse jsonpath and return a root of a linked list of nodes
-func parsePath(path []byte) (*tNode, int, error) {
+// parse jsonpath and return a root of a linked list of nodes.
+// If glob is set, a '*' within a key makes it a pattern (in filters '*' is a multiplication).
+func parsePath(path []byte, glob bool) (*tNode, int, error) {
 	var err error
 	var done bool
 	var nod *tNode
@@ -212,15 +1094,18 @@ func parsePath(path []byte) (*tNode, int, error) {
 	}
 
 	// get key
-	if path[i] == '*' {
+	if path[i] == '*' && (!glob || i+1 == l || bytein(path[i+1], keyTerminator)) {
 		i++
 	} else {
-		for ; i < l && !bytein(path[i], keyTerminator); i++ {
+		for ; i < l && (!bytein(path[i], keyTerminator) || (glob && path[i] == '*')); i++ {
 		}
 	}
 
 	nod = getEmptyNode()
 	nod.Key = path[:i]
+	if glob && len(nod.Key) > 1 && bytes.IndexByte(nod.Key, '*') >= 0 {
+		nod.Type |= cGlob
+	}
 
 	if i == l {
 		// finished parsing
@@ -233,20 +1118,29 @@ func parsePath(path []byte) (*tNode, int, error) {
 	if len(nod.Key) == 0 && len(nod.Keys) == 1 {
 		nod.Key = nod.Keys[0]
 		nod.Keys = nil
+		nod.Type |= cQuoted
 	}
+	head := nod
 	if len(nod.Key) != 0 && len(nod.Keys) > 0 {
+		// key['a','b']: the key list is a separate node
 		mid := nod
-		nod := getEmptyNode()
-		nod.Keys = mid.Keys
+		nod = getEmptyNode()
 		nod.Type = mid.Type
+		if len(mid.Keys) == 1 {
+			nod.Key = mid.Keys[0]
+			nod.Type |= cQuoted
+		} else {
+			nod.Keys = mid.Keys
+		}
+		mid.Keys = nil
 		mid.Type = mid.Type & (^cIsTerminal)
 		mid.Next = nod
 	}
 	if done || err != nil {
-		return nod, i, err
+		return head, i, err
 	}
 
-	next, j, err := parsePath(path[i:])
+	next, j, err := parsePath(path[i:], glob)
 	i += j
 	if err != nil {
 		return nil, i, err
@@ -255,15 +1149,22 @@ func parsePath(path []byte) (*tNode, int, error) {
 	if next.Type&cFunction > 0 {
 		nod.Type |= cSubject
 	}
-	return nod, i, nil
+	if nod.Type&cDeep > 0 {
+		// arrays found by a deep scan contribute what they have
+		next.Type |= cClamped
+	}
+	return head, i, nil
 }
 
+// pathSpace is the whitespace allowed around a jsonpath
+const pathSpace = " \t\r\n"
+
 var pathTerminator = []byte{' ', '\t', '<', '=', '>', '+', '-', '*', '/', ')', '&', '|'}
 
 func nodeType(path []byte, i int, nod *tNode) (bool, int, error) {
 	var err error
 	l := len(path)
-	if path[i] == '(' && i < l-1 && path[i+1] == ')' {
+	if path[i] == '(' && bytes.IndexByte(path[i:], ')') > 0 {
 		// function
 		return detectFn(path, i, nod)
 	} else if path[i] == '[' {
@@ -289,6 +1190,9 @@ func nodeType(path []byte, i int, nod *tNode) (bool, int, error) {
 		if path[i] == '.' {
 			nod.Type |= cDeep
 			i++
+			if i == l || path[i] == '.' {
+				return true, i, errPathDeepScanTarget
+			}
 		}
 	} else if ch != '[' { // nested array
 		return true, i, errPathInvalidReference
@@ -297,13 +1201,41 @@ func nodeType(path []byte, i int, nod *tNode) (bool, int, error) {
 }
 
 func detectFn(path []byte, i int, nod *tNode) (bool, int, error) {
-	if !(bytes.EqualFold(nod.Key, []byte("length")) ||
+	e := i + bytes.IndexByte(path[i:], ')')
+	nod.Arg = bytes.TrimSpace(path[i+1 : e])
+	switch {
+	case bytes.EqualFold(nod.Key, []byte("length")) ||
 		bytes.EqualFold(nod.Key, []byte("count")) ||
-		bytes.EqualFold(nod.Key, []byte("size"))) {
-		return true, i, errPathUnknownFunction
+		bytes.EqualFold(nod.Key, []byte("size")) ||
+		aggregateFunc(nod.Key):
+		if len(nod.Arg) > 0 {
+			return true, i + 1, errPathFunctionArgument
+		}
+	case bytes.EqualFold(nod.Key, []byte("nth")):
+		// element index, negative counts from the end
+		n, err := strconv.Atoi(string(nod.Arg))
+		if err != nil {
+			return true, i + 1, errPathFunctionArgument
+		}
+		nod.Left = n
+	case bytes.EqualFold(nod.Key, []byte("first")) || bytes.EqualFold(nod.Key, []byte("last")):
+		// nth(0) and nth(-1)
+		if len(nod.Arg) > 0 {
+			return true, i + 1, errPathFunctionArgument
+		}
+		if bytes.EqualFold(nod.Key, []byte("last")) {
+			nod.Left = -1
+		}
+	default:
+		if _, ok := registeredFunc(nod.Key); !ok {
+			return true, i, errPathUnknownFunction
+		}
+		if len(nod.Arg) > 0 {
+			return true, i + 1, errPathFunctionArgument
+		}
 	}
 	nod.Type |= cFunction
-	i += 2
+	i = e + 1
 	if i == len(path) {
 		nod.Type |= cIsTerminal
 	}
@@ -317,7 +1249,7 @@ func parseArrayIndex(path []byte, i int, nod *tNode) (int, error) {
 	if i < l && path[i] == '\'' {
 		return parseKeyList(path, i, nod)
 	}
-	nod.Type = cArrayType
+	nod.Type |= cArrayType
 	if i < l-1 && path[i] == '?' && path[i+1] == '(' {
 		// filter
 		nod.Type |= cArrayRanged | cAgg
@@ -325,11 +1257,17 @@ func parseArrayIndex(path []byte, i int, nod *tNode) (int, error) {
 		if err != nil {
 			return i, err
 		}
+		if i >= l || path[i] != ')' {
+			return i, errFilterUnterminated
+		}
 		i++ // )
 	} else {
 		// single index, slice or index list
-		i, err = readArrayIndex(path, i, nod)
-		if err != nil {
+		if i < l-1 && path[i] == '*' && path[i+1] == ']' {
+			// [*] selects all elements, same as [:]
+			nod.Type |= cArrayRanged | cAgg
+			i++
+		} else if i, err = readArrayIndex(path, i, nod); err != nil {
 			return i, err
 		}
 	}
@@ -346,21 +1284,29 @@ func parseArrayIndex(path []byte, i int, nod *tNode) (int, error) {
 func parseKeyList(path []byte, i int, nod *tNode) (int, error) {
 	l := len(path)
 	// now at '
-	for i < l && path[i] != ']' {
-		i++ // skip '
-		e := i
-		for ; e < l && path[e] != '\''; e++ {
+	for {
+		e, err := skipString(path, i)
+		if err != nil {
+			return l, errPathKeyListTerminated
+		}
+		nod.Keys = append(nod.Keys, unquoteKey(path[i+1:e-1]))
+		i = skipPathSpaces(path, e)
+		if i == l {
+			return i, errPathKeyListTerminated
+		}
+		if path[i] == ']' {
+			break
 		}
-		if e == l {
+		if path[i] != ',' {
+			return i, errPathKeyListSeparator
+		}
+		i = skipPathSpaces(path, i+1)
+		if i == l {
 			return i, errPathKeyListTerminated
 		}
-		nod.Keys = append(nod.Keys, path[i:e])
-		i = e + 1 // skip '
-		for ; i < l && path[i] != '\'' && path[i] != ']'; i++ {
-		} // sek to next ' or ]
-	}
-	if i == l {
-		return i, errPathKeyListTerminated
+		if path[i] != '\'' {
+			return i, errPathKeyListKey
+		}
 	}
 	i++ // ]
 	if i == l {
@@ -369,183 +1315,617 @@ func parseKeyList(path []byte, i int, nod *tNode) (int, error) {
 	return i, nil
 }
 
+// unquoteKey turns \' of a single-quoted key into ', other escapes are kept as they are spelled in json
+func unquoteKey(key []byte) []byte {
+	if !bytes.Contains(key, []byte{'\\', '\''}) {
+		return key
+	}
+	unquoted := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		if key[i] == '\\' && key[i+1] == '\'' {
+			i++
+		} else if key[i] == '\\' {
+			unquoted = append(unquoted, key[i])
+			i++
+		}
+		unquoted = append(unquoted, key[i])
+	}
+	return unquoted
+}
+
 func readArrayIndex(path []byte, i int, nod *tNode) (int, error) {
 	l := len(path)
-	num := 0
-	num, i = readInt(path, i)
-	if i == l || !bytein(path[i], []byte{':', ',', ']'}) {
-		return i, errPathIndexBoundMissing
+	var err error
+	for {
+		var el tSlice
+		i = skipPathSpaces(path, i)
+		s := i
+		el.Left, i, err = readInt(path, i)
+		if err != nil {
+			return i, err
+		}
+		left := i > s
+		i = skipPathSpaces(path, i)
+		if i < l && path[i] == ':' {
+			el.Ranged = true
+			i = skipPathSpaces(path, i+1)
+			r := i
+			num, ii, err := readInt(path, i)
+			if err != nil {
+				return ii, err
+			}
+			right := ii > r
+			el.Right = num
+			i = skipPathSpaces(path, ii)
+			if i < l && path[i] == ':' {
+				// step
+				i = skipPathSpaces(path, i+1)
+				num, ii, err := readInt(path, i)
+				if err != nil {
+					return ii, err
+				}
+				if ii-i > 0 && num == 0 {
+					return i, errPathStepNonsense
+				}
+				el.Step = num
+				i = skipPathSpaces(path, ii)
+			}
+			if el.Step < 0 {
+				// a reversed slice runs from the last element through the first one unless bounded
+				if !left {
+					el.Left = -1
+				}
+				if !right {
+					el.Right = upToFirst
+				}
+			} else if right && el.Right == 0 {
+				return r, errPathIndexNonsense
+			}
+		}
+		if i == l || !bytein(path[i], []byte{',', ']'}) {
+			return i, errPathIndexBoundMissing
+		}
+		nod.Elems = append(nod.Elems, el)
+		if path[i] != ',' {
+			break
+		}
+		i++ // ,
 	}
-	nod.Left = num
-
-	switch path[i] {
-	case ',':
+	if len(nod.Elems) > 1 {
 		nod.Type |= cArrayRanged | cAgg
-		nod.Elems = append(nod.Elems, num)
-		for i < l && path[i] != ']' {
-			i++
-			num, i = readInt(path, i)
-			nod.Elems = append(nod.Elems, num)
-		}
-	case ':':
+		return i, nil
+	}
+	// a single index or slice
+	el := nod.Elems[0]
+	nod.Elems = nod.Elems[:0]
+	nod.Left = el.Left
+	nod.Right = el.Right
+	nod.Step = el.Step
+	if el.Ranged {
 		nod.Type |= cArrayRanged | cAgg
+	}
+	return i, nil
+}
+
+// skipPathSpaces skips spaces within brackets of jsonpath
+func skipPathSpaces(path []byte, i int) int {
+	for i < len(path) && path[i] == ' ' {
 		i++
-		num, ii := readInt(path, i)
-		if ii-i > 0 && num == 0 {
-			return i, errPathIndexNonsense
+	}
+	return i
+}
+
+// elemIndexes returns the positions of the elements selected by the index list of nod in an array of n elements.
+// Overlapping members select the same elements again.
+func elemIndexes(nod *tNode, n int) ([]int, error) {
+	if len(nod.Elems) == 0 {
+		// a single slice
+		return sliceIndexes(tSlice{Left: nod.Left, Right: nod.Right, Step: nod.Step, Ranged: true}, n, nod.Type&cClamped > 0, nil)
+	}
+	idx := make([]int, 0, len(nod.Elems))
+	for _, el := range nod.Elems {
+		if !el.Ranged {
+			a := el.Left
+			if a < 0 {
+				a += n
+			}
+			if a < 0 || a >= n {
+				return nil, ErrArrayElementNotFound
+			}
+			idx = append(idx, a)
+			continue
+		}
+		var err error
+		if idx, err = sliceIndexes(el, n, nod.Type&cClamped > 0, idx); err != nil {
+			return nil, err
 		}
-		i = ii
-		nod.Right = num
 	}
-	return i, nil
+	return idx, nil
 }
 
-func getValue(input []byte, nod *tNode) (result []byte, err error) {
+// sliceIndexes appends the positions of the elements selected by a slice of an array of n elements to idx
+func sliceIndexes(el tSlice, n int, clamp bool, idx []int) ([]int, error) {
+	if el.Step < 0 {
+		a, b, err := reverseBounds(el.Left, el.Right, n, clamp)
+		if err != nil {
+			return nil, err
+		}
+		for ; a >= b; a += el.Step {
+			idx = append(idx, a)
+		}
+		return idx, nil
+	}
+	a, b, err := adjustBounds(el.Left, el.Right, n, clamp)
+	if err != nil {
+		return nil, err
+	}
+	for ; a <= b; a += sliceStep(el.Step) {
+		idx = append(idx, a)
+	}
+	return idx, nil
+}
 
+// getValue returns the value matching the node chain, the matches of an aggregating one merged into an array
+func getValue(q *tQuery, input []byte, nod *tNode) ([]byte, error) {
+	m := tMatches{c: cMerged}
+	err := getMatches(q, &m, input, nod)
+	return m.value, err
+}
+
+// nodeValue processes the value of the node key, see getValue
+func nodeValue(q *tQuery, input []byte, nod *tNode) ([]byte, error) {
+	m := tMatches{c: cMerged}
+	err := nodeMatches(q, &m, input, nod)
+	return m.value, err
+}
+
+// getElements appends every value matching the node chain to elems, counted by the query.
+// Unlike getValue it never merges the results, so each element is a subslice of input
+// unless it is the result of a function.
+func getElements(q *tQuery, input []byte, nod *tNode, elems [][]byte) ([][]byte, error) {
+	m := tMatches{c: cCounted, elems: elems}
+	err := getMatches(q, &m, input, nod)
+	if err != nil && !errors.Is(err, ErrPartialResult) {
+		return nil, err
+	}
+	return m.elems, err
+}
+
+// getMatches collects the matches of the node chain into m
+func getMatches(q *tQuery, m *tMatches, input []byte, nod *tNode) error {
+	var err error
+
+	if err = scanned(q, 0); err != nil {
+		return err
+	}
 	i, _ := skipSpaces(input, 0)
 
 	input = input[i:]
 	if err = looksLikeJSON(input); err != nil {
-		return nil, err
+		return err
 	}
 	// wildcard
-	if len(nod.Key) == 1 && nod.Key[0] == '*' {
-		return wildScan(input, nod)
+	if isWildcard(nod) {
+		return wildMatches(q, m, input, nod)
+	}
+	if nod.Type&cGlob > 0 {
+		return globMatches(q, m, input, nod)
+	}
+	if len(nod.Keys) > 0 && len(nod.Key) == 0 && m.c != cMerged {
+		return keyListMatches(q, m, input, nod)
 	}
 	if len(nod.Keys) > 0 || (len(nod.Key) > 0 && nod.Key[0] != '$' && nod.Key[0] != '@') {
 		// find the key and seek to the value
-		input, err = getKeyValue(input, nod)
+		if input[0] != '{' {
+			return errObjectExpected
+		}
+		input, err = getKeyValue(q, input, nod)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nodeMatches(q, m, input, nod)
+}
+
+// nodeMatches processes the value of the node key
+func nodeMatches(q *tQuery, m *tMatches, input []byte, nod *tNode) error {
+	var err error
+
 	// check value type
 	if err = checkValueType(input, nod); err != nil {
-		return nil, err
+		return err
 	}
 
 	// here we are at the beginning of a value
 
+	if nod.Type&cDeep > 0 {
+		if nod.Type&cArrayType > 0 {
+			if input, err = sliceArray(q, input, nod); err != nil {
+				return err
+			}
+		}
+		if m.c != cMerged {
+			return deepElements(q, m, input, nod.Next, 1, nil)
+		}
+		// the results are merged into an array
+		sub := tMatches{c: cApart}
+		if err = deepElements(q, &sub, input, nod.Next, 1, nil); err != nil && !errors.Is(err, ErrPartialResult) {
+			return err
+		}
+		m.value = mergeElements(sub.elems)
+		return err
+	}
 	if nod.Type&cSubject > 0 {
-		return doFunc(input, nod.Next)
+		if nod.Type&cArrayType > 0 {
+			// apply the function to the selected element(s)
+			if input, err = sliceArray(q, input, nod); err != nil {
+				return err
+			}
+		}
+		value, err := doFunc(q, input, nod.Next)
+		if err != nil {
+			return err
+		}
+		m.add(q, value)
+		return nil
+	}
+	if nod.Type&cIsTerminal > 0 && nod.Type&cArrayType == 0 {
+		eoe, err := skipValue(input, 0)
+		if err != nil {
+			return err
+		}
+		m.add(q, input[:eoe])
+		return nil
+	}
+	if nod.Type&cArrayType == 0 {
+		return getMatches(q, m, input, nod.Next)
+	}
+	if nod.Type&cAgg == 0 {
+		if input, err = sliceArray(q, input, nod); err != nil {
+			return err
+		}
+		if nod.Type&cIsTerminal > 0 {
+			m.add(q, input)
+			return nil
+		}
+		return getMatches(q, m, input, nod.Next)
+	}
+	if m.c == cMerged && nod.Type&cIsTerminal > 0 {
+		// the elements as they are in the array
+		m.value, err = sliceArray(q, input, nod)
+		return err
+	}
+	selected, err := selectElements(q, input, nod)
+	if err != nil {
+		return err
 	}
 	if nod.Type&cIsTerminal > 0 {
-		return termValue(input, nod)
+		m.add(q, selected...)
+		return nil
 	}
-	if nod.Type&cArrayType > 0 {
-		if input, err = sliceArray(input, nod); err != nil {
-			return nil, err
+	var found [][]byte
+	for _, elem := range selected {
+		if m.enough(q) {
+			break
 		}
-		if nod.Type&cAgg > 0 {
-			return getNodes(input, nod.Next)
+		// elements lacking the sub-path are skipped
+		sub := tMatches{c: m.c}
+		if err := getMatches(q, &sub, elem, nod.Next); err == nil {
+			found = sub.appendTo(found)
 		}
 	}
-	return getValue(input, nod.Next)
+	if m.c == cMerged && len(found) == 0 {
+		return nil
+	}
+	m.gather(found)
+	return nil
 }
 
-func wildScan(input []byte, nod *tNode) (result []byte, err error) {
-	result = []byte{}
-	separator := byte('[')
-	for {
-		input, err = getKeyValue(input, nod)
+// deepElements collects the matches found at the current level first, then the ones found in object values and array elements.
+// parent is the raw json key or index input was found at (nil for the starting level).
+func deepElements(q *tQuery, m *tMatches, input []byte, nod *tNode, depth int, parent []byte) error {
+	// values lacking the sub-path are skipped
+	sub := tMatches{c: m.c}
+	if err := getMatches(q, &sub, input, nod); err == nil || errors.Is(err, ErrPartialResult) {
+		if nod.Opts != nil && nod.Opts.WithParents {
+			sub.elems = parentElements(sub.elems, parent)
+		}
+		m.elems = append(m.elems, sub.elems...)
+	}
+	if input[0] != '{' && input[0] != '[' {
+		return nil
+	}
+	if nod.Opts != nil && nod.Opts.MaxScanDepth > 0 && depth >= nod.Opts.MaxScanDepth {
+		return nil
+	}
+	i, err := skipSpaces(input, 1)
+	if err != nil {
+		return recoverPartial(nod, err)
+	}
+	var key []byte
+	for n := 0; input[i] != '}' && input[i] != ']' && !m.enough(q); n++ {
+		if input[0] == '{' {
+			if input[i] != '"' {
+				return recoverPartial(nod, errKeyExpected)
+			}
+			e, err := skipString(input, i)
+			if err != nil {
+				return recoverPartial(nod, err)
+			}
+			key = input[i:e]
+			if i, err = seekToValue(input, e); err != nil {
+				return recoverPartial(nod, err)
+			}
+		} else {
+			key = strconv.AppendInt(key[:0], int64(n), 10)
+		}
+		e, err := skipValue(input, i)
 		if err != nil {
-			return nil, err
+			if nod.Opts != nil && nod.Opts.RecoverPartial {
+				// the value is cut short, descend into what is left of it
+				if err = deepElements(q, m, input[i:], nod, depth+1, key); err != nil {
+					return err
+				}
+			}
+			return recoverPartial(nod, errUnexpectedEnd)
+		}
+		if err = scanned(q, e-i); err != nil {
+			return err
 		}
-		var elem []byte
-		skip := 0
+		if err = deepElements(q, m, input[i:e], nod, depth+1, key); err != nil {
+			return err
+		}
+		if i, err = skipSpaces(input, e); err != nil {
+			return recoverPartial(nod, err)
+		}
+	}
+	return nil
+}
 
-		if nod.Type&cIsTerminal > 0 {
-			// any field type matches
-			elem, err = termValue(input, nod)
-			skip = len(elem)
+// recoverPartial wraps err into ErrPartialResult if the options allow keeping the matches collected so far,
+// otherwise err is returned as is. Exceeding the scan limit is not recovered.
+func recoverPartial(nod *tNode, err error) error {
+	if errors.Is(err, ErrPartialResult) {
+		return err
+	}
+	if err != errScanLimit && nod.Opts != nil && nod.Opts.RecoverPartial {
+		return fmt.Errorf("%w: %v", ErrPartialResult, err)
+	}
+	return err
+}
+
+// parentElements wraps each element into {"parent":parent,"value":element}
+func parentElements(elems [][]byte, parent []byte) [][]byte {
+	if len(parent) == 0 {
+		parent = []byte("null")
+	}
+	for i, elem := range elems {
+		res := make([]byte, 0, len(elem)+len(parent)+20)
+		res = append(append(append(res, `{"parent":`...), parent...), `,"value":`...)
+		elems[i] = append(append(res, elem...), '}')
+	}
+	return elems
+}
+
+// globMatches: process the values of every key matching the node key pattern
+func globMatches(q *tQuery, m *tMatches, input []byte, nod *tNode) error {
+	if input[0] != '{' {
+		return errObjectExpected
+	}
+	keys, vals, err := objectMembers(input)
+	if err != nil {
+		return err
+	}
+	var found [][]byte
+	for i, key := range keys {
+		if m.enough(q) {
+			break
+		}
+		if !globMatch(nod.Key, key) {
+			continue
+		}
+		// nodeMatches expects the value followed by the rest of the input.
+		// values lacking the sub-path are skipped
+		off, _ := offsetOf(input, vals[i])
+		sub := tMatches{c: m.c}
+		if err := nodeMatches(q, &sub, input[off:], nod); err == nil {
+			found = sub.appendTo(found)
+		}
+	}
+	m.gather(found)
+	return nil
+}
+
+// globMatch reports whether key matches the pattern where '*' stands for any sequence of characters.
+// Like keys, patterns are case insensitive.
+func globMatch(pattern []byte, key []byte) bool {
+	p, k := 0, 0
+	star, next := -1, 0
+	for k < len(key) {
+		if p < len(pattern) && pattern[p] == '*' {
+			star, next = p, k
+			p++
+		} else if p < len(pattern) && lower(pattern[p]) == lower(key[k]) {
+			p++
+			k++
+		} else if star >= 0 {
+			// backtrack: let the last '*' take one more character
+			next++
+			p, k = star+1, next
 		} else {
-			if skip, err = skipValue(input, 0); err != nil {
-				return nil, err
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func lower(ch byte) byte {
+	if ch >= 'A' && ch <= 'Z' {
+		return ch + 'a' - 'A'
+	}
+	return ch
+}
+
+// wildMatches: process every value of an object or every element of an array
+func wildMatches(q *tQuery, m *tMatches, input []byte, nod *tNode) error {
+	var err error
+	var found [][]byte
+	closing := wildClosing(input)
+	if closing == ']' {
+		input = input[1:] // skip '['
+	}
+	for !m.enough(q) {
+		if input, err = wildNext(q, input, nod, closing); err != nil {
+			return m.partial(nod, found, err)
+		}
+		if input == nil {
+			break // empty array
+		}
+		skip, err := skipValue(input, 0)
+		if err != nil {
+			return m.partial(nod, found, err)
+		}
+		if err = scanned(q, skip); err != nil {
+			return err
+		}
+
+		if nod.Type&cIsTerminal > 0 && nod.Type&cArrayType == 0 {
+			// any field type matches
+			sub := tMatches{c: m.c}
+			sub.add(q, input[:skip])
+			found = sub.appendTo(found)
+		} else if input[0] == '[' || (input[0] == '{' && nod.Type&cArrayType == 0) {
+			// values lacking the sub-path are skipped, just like the elements of an aggregating array step
+			sub := tMatches{c: m.c}
+			if err = nodeMatches(q, &sub, input[:skip], nod); err != nil && !isNotFound(err) && !isTypeMismatch(err) {
+				return m.partial(nod, found, err)
 			}
-			switch input[0] {
-			case '[': // array type -- aggregate fields
-				if nod.Type&cArrayType > 0 {
-					if elem, err = getNodes(input, nod.Next); err != nil {
-						return nil, err
-					}
-					if len(elem) > 2 {
-						elem = elem[1 : len(elem)-1]
-					}
-				}
-			case '{': // object type -- process jsonpath query
-				if nod.Type&cArrayType == 0 {
-					if elem, err = getValue(input[:skip], nod.Next); err != nil {
-						return nil, err
-					}
-				}
+			if err == nil && m.c == cMerged && len(sub.value) > 0 && nod.Type&cIsTerminal == 0 && (nod.Type&cAgg > 0 || aggregates(nod.Next)) {
+				// merge the matches of nested aggregation into a single array
+				sub.value = bytes.TrimSpace(sub.value[1 : len(sub.value)-1])
+			}
+			if err == nil {
+				found = sub.appendTo(found)
 			}
-		}
-		if len(elem) > 0 {
-			result = append(append(result, separator), elem...)
-			separator = ','
 		}
 		input = input[skip:]
 
 		i, err := skipSpaces(input, 0)
 		if err != nil {
-			return nil, err
+			return m.partial(nod, found, err)
 		}
-		if input[i] == '}' {
+		if input[i] == closing {
 			break
 		}
 	}
-	return append(result, ']'), nil
+	m.gather(found)
+	return nil
+}
+
+// wildClosing returns the closing bracket of the object or array being wildcard-scanned
+func wildClosing(input []byte) byte {
+	if input[0] == '[' {
+		return ']'
+	}
+	return '}'
 }
 
-func termValue(input []byte, nod *tNode) ([]byte, error) {
-	if nod.Type&cArrayType > 0 {
-		return sliceArray(input, nod)
+// wildNext seeks to the next value of an object or the next element of an array.
+// Returns nil if there are no more elements in the array.
+func wildNext(q *tQuery, input []byte, nod *tNode, closing byte) ([]byte, error) {
+	if closing == '}' {
+		return getKeyValue(q, input, nod)
 	}
-	eoe, err := skipValue(input, 0)
+	i, err := skipSpaces(input, 0)
 	if err != nil {
 		return nil, err
 	}
-	return input[:eoe], nil
+	if input[i] == ']' {
+		return nil, nil
+	}
+	return input[i:], nil
 }
 
-func getNodes(input []byte, nod *tNode) ([]byte, error) {
-	var err error
-	var value []byte
-	var e int
-	l := len(input)
-	i := 1 // skip '['
-
-	i, err = skipSpaces(input, i)
-	if err != nil {
-		return nil, err
+// keyListMatches collects the values of the key list of the node apart, see getMatches
+func keyListMatches(q *tQuery, m *tMatches, input []byte, nod *tNode) error {
+	if input[0] != '{' {
+		return errObjectExpected
 	}
-	// scan for elements
-	var result []byte
-	for i < l && input[i] != ']' {
-		value, err = getValue(input[i:], nod)
-		if err == nil {
-			if len(result) == 0 {
-				result = []byte{'['}
-			} else {
-				result = append(result, ',')
-			}
-			result = append(result, value...)
+	keys := make([][]byte, len(nod.Keys))
+	var names [][]byte
+	if keyListAsObject(nod) {
+		names = make([][]byte, len(nod.Keys))
+	}
+	if _, err := seekKey(q, input, nod, keys, names); err != nil {
+		return err
+	}
+	if names != nil {
+		m.add(q, keyListObject(names, keys))
+		return nil
+	}
+	found := make([][]byte, 0, len(keys))
+	for _, val := range keys {
+		if len(val) > 0 {
+			found = append(found, val)
 		}
-		// skip value
-		e, err = skipValue(input, i)
-		if err != nil {
-			return nil, err
+	}
+	if nod.Next == nil {
+		m.add(q, found...)
+		return nil
+	}
+	if !indexesArray(nod.Next) {
+		return errObjectExpected
+	}
+	return keyListElements(q, m, found, nod.Next)
+}
+
+// keyListElements applies the array step nod to the values selected by a key list.
+// The values are merged into a synthetic array, the matches are then mapped back onto the values
+// and only then counted.
+func keyListElements(q *tQuery, m *tMatches, found [][]byte, nod *tNode) error {
+	merged := mergeElements(found)
+	starts := make([]int, len(found))
+	off := 1 // [
+	for k, val := range found {
+		starts[k] = off
+		off += len(val) + 1 // ,
+	}
+	sub := tMatches{c: cApart}
+	if err := nodeMatches(q, &sub, merged, nod); err != nil {
+		return err
+	}
+	for _, elem := range sub.elems {
+		off, ok := offsetOf(merged, elem)
+		if !ok {
+			m.add(q, elem) // a function result
+			continue
 		}
-		// skip spaces after value
-		i, err = skipSpaces(input, e)
+		k := sort.SearchInts(starts, off+1) - 1
+		if k < 0 {
+			return errSubslicingNotSupported
+		}
+		off -= starts[k]
+		m.add(q, found[k][off:off+len(elem)])
+	}
+	return nil
+}
+
+// selectElements returns array elements selected by index, bounds or filter
+func selectElements(q *tQuery, input []byte, nod *tNode) ([][]byte, error) {
+	if nod.Filter != nil {
+		if input[0] != '[' {
+			return nil, errArrayExpected
+		}
+		i, err := skipSpaces(input, 1)
 		if err != nil {
 			return nil, err
 		}
+		return filterElements(q, input, i, nod, nil)
 	}
-	if len(result) > 0 {
-		result = append(result[:len(result):len(result)], ']')
-	}
-	return result, nil
+	return sliceArrayElements(q, input, nod, 0)
 }
 
 const keySeek = 1
@@ -553,7 +1933,80 @@ const keyOpen = 2
 const keyClose = 4
 
 // getKeyValue: find the key and seek to the value. Cut value if needed
-func getKeyValue(input []byte, nod *tNode) ([]byte, error) {
+func getKeyValue(q *tQuery, input []byte, nod *tNode) ([]byte, error) {
+	separator := byte('[')
+
+	elems := make([][]byte, len(nod.Keys))
+	var names [][]byte
+	if keyListAsObject(nod) {
+		names = make([][]byte, len(elems))
+		if len(elems) == 0 {
+			names = [][]byte{nil} // a single key
+		}
+	}
+	value, err := seekKey(q, input, nod, elems, names)
+	if err != nil || (value != nil && names == nil) {
+		return value, err
+	}
+	if names != nil {
+		if len(nod.Keys) == 0 {
+			// a single bracket-notated key as a key list of one
+			elems = [][]byte{nil}
+			if value != nil {
+				eoe, err := skipValue(value, 0)
+				if err != nil {
+					return nil, err
+				}
+				elems[0] = value[:eoe]
+			}
+		}
+		return keyListObject(names, elems), nil
+	}
+	if value != nil {
+		return value, nil
+	}
+	if len(nod.Keys) > 0 {
+		ret := []byte{}
+		for i := 0; i < len(nod.Keys); i++ {
+			if len(elems[i]) > 0 {
+				ret = append(ret, separator)
+				ret = append(ret, elems[i]...)
+				separator = ','
+			}
+		}
+		return append(ret, ']'), nil
+	}
+	return nil, ErrArrayElementNotFound
+}
+
+// keyListAsObject reports whether the values of the terminal key list of the node are returned as an object.
+// A single bracket-notated key ($['a']) is a key list too.
+func keyListAsObject(nod *tNode) bool {
+	return nod.Next == nil && nod.Opts != nil && nod.Opts.KeyListAsObject &&
+		(len(nod.Keys) > 0 || (nod.Type&cQuoted > 0 && nod.Type&cArrayType == 0))
+}
+
+// keyListObject returns an object of the keys found, in the order of the key list.
+// The keys are the raw ones of the document, which may differ in case from the key list.
+func keyListObject(names [][]byte, elems [][]byte) []byte {
+	ret := []byte{'{'}
+	for i, name := range names {
+		if len(elems[i]) == 0 {
+			continue // missing keys are omitted
+		}
+		if len(ret) > 1 {
+			ret = append(ret, ',')
+		}
+		ret = append(append(append(ret, '"'), name...), '"', ':')
+		ret = append(ret, elems[i]...)
+	}
+	return append(ret, '}')
+}
+
+// seekKey: scan the object for nod.Key and return the input starting at its value.
+// Values of nod.Keys found along the way are stored in elems, their raw keys in names unless it is nil.
+// Returns nil if the key is not found.
+func seekKey(q *tQuery, input []byte, nod *tNode, elems [][]byte, names [][]byte) ([]byte, error) {
 	var (
 		err error
 		ch  byte
@@ -562,16 +2015,23 @@ func getKeyValue(input []byte, nod *tNode) ([]byte, error) {
 	)
 	i := 1
 	l := len(input)
-	separator := byte('[')
-
-	ret := []byte{}
-	elems := make([][]byte, len(nod.Keys))
+	found := -1
+	policy := duplicateKeyPolicy(nod)
 
-	for i < l && input[i] != '}' {
+	for i < l {
+		// input ending before the closing brace is an error, not a missing key
+		if i, err = skipSpaces(input, i); err != nil {
+			return nil, err
+		}
+		if input[i] == '}' {
+			break
+		}
 		state := keySeek
 		for i < l && state != keyClose {
 			ch = input[i]
-			if ch == '"' {
+			if ch == '\\' && state == keyOpen {
+				i++ // escaped character, the key is not closed yet
+			} else if ch == '"' {
 				if state == keySeek {
 					state = keyOpen
 					s = i + 1
@@ -589,30 +2049,54 @@ func getKeyValue(input []byte, nod *tNode) ([]byte, error) {
 				return nil, err
 			}
 			var hit bool
-			hit, i, err = keyCheck(input[s:e], input, i, nod, elems)
-			if hit || err != nil {
-				return input[i:], err
+			hit, i, err = keyCheck(input[s:e], input, i, nod, elems, names)
+			if err != nil {
+				return nil, err
 			}
-		}
-	}
-	if len(nod.Keys) > 0 {
-		for i := 0; i < len(nod.Keys); i++ {
-			if len(elems[i]) > 0 {
-				ret = append(ret, separator)
-				ret = append(ret, elems[i]...)
-				separator = ','
+			if hit {
+				if names != nil && len(nod.Keys) == 0 {
+					names[0] = input[s:e]
+				}
+				// a wildcard takes every key in turn, the policy applies to the exact key hits only
+				if policy == DuplicateKeyFirst || isWildcard(nod) {
+					return input[i:], scanned(q, i)
+				}
+				if found >= 0 && policy == DuplicateKeyError {
+					return nil, errDuplicateKey
+				}
+				found = i
+				// look for duplicates
+				if i, err = skipValue(input, i); err != nil {
+					return nil, err
+				}
 			}
 		}
-		return append(ret, ']'), nil
 	}
-	return nil, errArrayElementNotFound
+	if i >= l {
+		return nil, errUnexpectedEnd
+	}
+	if err = scanned(q, i); err != nil {
+		return nil, err
+	}
+	if found >= 0 {
+		return input[found:], nil
+	}
+	return nil, nil
+}
+
+// duplicateKeyPolicy returns the duplicate key policy of the node
+func duplicateKeyPolicy(nod *tNode) DuplicateKeyPolicy {
+	if nod.Opts != nil {
+		return nod.Opts.DuplicateKey
+	}
+	return DuplicateKeyFirst
 }
 
-func keyCheck(key []byte, input []byte, i int, nod *tNode, elems [][]byte) (bool, int, error) {
+func keyCheck(key []byte, input []byte, i int, nod *tNode, elems [][]byte, names [][]byte) (bool, int, error) {
 	var e int
 	var err error
 
-	if bytes.EqualFold(nod.Key, key) || (len(nod.Key) == 1 && nod.Key[0] == '*') {
+	if (len(nod.Key) > 0 && bytes.EqualFold(nod.Key, key)) || isWildcard(nod) {
 		return true, i, nil // single key hit
 	}
 
@@ -628,7 +2112,18 @@ func keyCheck(key []byte, input []byte, i int, nod *tNode, elems [][]byte) (bool
 
 	for ii, k := range nod.Keys {
 		if bytes.EqualFold(k, key) {
+			if elems[ii] != nil {
+				switch duplicateKeyPolicy(nod) {
+				case DuplicateKeyFirst:
+					return false, i, nil
+				case DuplicateKeyError:
+					return false, i, errDuplicateKey
+				}
+			}
 			elems[ii] = input[s:e]
+			if names != nil {
+				names[ii] = key
+			}
 			return false, i, nil
 		}
 	}
@@ -642,7 +2137,7 @@ type tElem struct {
 }
 
 // sliceArray select node(s) by bound(s)
-func sliceArray(input []byte, nod *tNode) ([]byte, error) {
+func sliceArray(q *tQuery, input []byte, nod *tNode) ([]byte, error) {
 	if input[0] != '[' {
 		return nil, errArrayExpected
 	}
@@ -650,11 +2145,11 @@ func sliceArray(input []byte, nod *tNode) ([]byte, error) {
 
 	if nod.Type&cArrayRanged == 0 && nod.Left >= 0 && len(nod.Elems) == 0 {
 		// single positive index -- easiest case
-		return getArrayElement(input, i, nod)
+		return getArrayElement(q, input, i, nod)
 	}
 	if nod.Filter != nil {
 		// filtered array
-		return getFilteredElements(input, i, nod)
+		return getFilteredElements(q, input, i, nod)
 	}
 
 	// fullscan
@@ -664,10 +2159,17 @@ func sliceArray(input []byte, nod *tNode) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(nod.Elems) > 0 {
+	if err = scanned(q, arrayEnd(elems)); err != nil {
+		return nil, err
+	}
+	if len(nod.Elems) > 0 || stepped(nod) {
+		idx, err := elemIndexes(nod, len(elems))
+		if err != nil {
+			return nil, err
+		}
 		result := []byte{'['}
-		for _, ii := range nod.Elems {
-			if len(result) > 2 {
+		for _, ii := range idx {
+			if len(result) > 1 {
 				result = append(result, ',')
 			}
 			result = append(result, input[elems[ii].start:elems[ii].end]...)
@@ -678,16 +2180,16 @@ func sliceArray(input []byte, nod *tNode) ([]byte, error) {
 	if nod.Type&cArrayRanged == 0 {
 		a := nod.Left + len(elems) // nod.Left is negative, so correct it to a real element index
 		if a < 0 {
-			return nil, errArrayElementNotFound
+			return nil, ErrArrayElementNotFound
 		}
 		return input[elems[a].start:elems[a].end], nil
 	}
 	// two bounds
-	a, b, err := adjustBounds(nod.Left, nod.Right, len(elems))
+	a, b, err := adjustBounds(nod.Left, nod.Right, len(elems), nod.Type&cClamped > 0)
 	if err != nil {
 		return nil, err
 	}
-	if len(elems) > 0 {
+	if len(elems) > 0 && a <= b {
 		input = input[elems[a].start:elems[b].end]
 		input = input[:len(input):len(input)]
 	} else {
@@ -696,6 +2198,53 @@ func sliceArray(input []byte, nod *tNode) ([]byte, error) {
 	return append([]byte{'['}, append(input, ']')...), nil
 }
 
+// countElements counts array elements starting at i
+func countElements(input []byte, i int) (int, error) {
+	n := 0
+	l := len(input)
+	for i < l && input[i] != ']' {
+		e, err := skipValue(input, i)
+		if err != nil {
+			return 0, err
+		}
+		n++
+		// skip spaces after value
+		i, err = skipSpaces(input, e)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// countMembers counts the keys of an object
+func countMembers(input []byte) (int, error) {
+	n := 0
+	i, err := skipSpaces(input, 1)
+	if err != nil {
+		return 0, err
+	}
+	for input[i] != '}' {
+		if input[i] != '"' {
+			return 0, errKeyExpected
+		}
+		if i, err = skipString(input, i); err != nil {
+			return 0, err
+		}
+		if i, err = seekToValue(input, i); err != nil {
+			return 0, err
+		}
+		if i, err = skipValue(input, i); err != nil {
+			return 0, err
+		}
+		n++
+		if i, err = skipSpaces(input, i); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
 func arrayScan(input []byte) ([]tElem, error) {
 	l := len(input)
 	elems := make([]tElem, 0, 32)
@@ -719,7 +2268,15 @@ func arrayScan(input []byte) ([]tElem, error) {
 	return elems, nil
 }
 
-func getArrayElement(input []byte, i int, nod *tNode) ([]byte, error) {
+// arrayEnd returns the end of the last element scanned
+func arrayEnd(elems []tElem) int {
+	if len(elems) == 0 {
+		return 0
+	}
+	return elems[len(elems)-1].end
+}
+
+func getArrayElement(q *tQuery, input []byte, i int, nod *tNode) ([]byte, error) {
 	var err error
 	l := len(input)
 	i, err = skipSpaces(input, i)
@@ -733,7 +2290,7 @@ func getArrayElement(input []byte, i int, nod *tNode) ([]byte, error) {
 			return nil, err
 		}
 		if ielem == nod.Left {
-			return input[i:e], nil
+			return input[i:e], scanned(q, e)
 		}
 		// skip spaces after value
 		i, err = skipSpaces(input, e)
@@ -742,27 +2299,58 @@ func getArrayElement(input []byte, i int, nod *tNode) ([]byte, error) {
 		}
 		ielem++
 	}
-	return nil, errArrayElementNotFound
+	return nil, ErrArrayElementNotFound
+}
+
+func getFilteredElements(q *tQuery, input []byte, i int, nod *tNode) ([]byte, error) {
+	if nod.Type&cIsTerminal > 0 && nod.Opts != nil && nod.Opts.WithIndices {
+		return getIndexedElements(q, input, i, nod)
+	}
+	elems, err := filterElements(q, input, i, nod, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mergeElements(elems), nil
+}
+
+// mergeElements joins the elements into an array
+func mergeElements(elems [][]byte) []byte {
+	result := []byte{'['}
+	for i, elem := range elems {
+		if i > 0 {
+			result = append(result, ',')
+		}
+		result = append(result, elem...)
+	}
+	return append(result, ']')
 }
 
-func getFilteredElements(input []byte, i int, nod *tNode) ([]byte, error) {
+// getIndexedElements returns filtered elements annotated with their positions in the array
+func getIndexedElements(q *tQuery, input []byte, i int, nod *tNode) ([]byte, error) {
 	l := len(input)
+	length, err := nod.Filter.arrayLength(input, i)
+	if err != nil {
+		return nil, err
+	}
 	result := []byte{'['}
 	// fullscan
-	for i < l && input[i] != ']' {
+	for n := 0; i < l && input[i] != ']'; n++ {
 		e, err := skipValue(input, i)
 		if err != nil {
 			return nil, err
 		}
-		b, err := filterMatch(input[i:e], nod.Filter.toks)
+		b, err := filterMatch(q, input[i:e], nod.Filter.toks, tPosition{n, length})
 		if err != nil {
 			return nil, err
 		}
 		if b {
-			if len(result) > 2 {
+			if len(result) > 1 {
 				result = append(result, ',')
 			}
-			result = append(result, input[i:e]...)
+			result = append(result, `{"index":`...)
+			result = strconv.AppendInt(result, int64(n), 10)
+			result = append(result, `,"value":`...)
+			result = append(append(result, input[i:e]...), '}')
 		}
 		// skip spaces after value
 		i, err = skipSpaces(input, e)
@@ -773,7 +2361,98 @@ func getFilteredElements(input []byte, i int, nod *tNode) ([]byte, error) {
 	return append(result, ']'), nil
 }
 
-func adjustBounds(left int, right int, n int) (int, int, error) {
+// filterElements appends array elements matching nod.Filter to res
+func filterElements(q *tQuery, input []byte, i int, nod *tNode, res [][]byte) ([][]byte, error) {
+	f := nod.Filter
+	length, err := f.arrayLength(input, i)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	return matchElements(input, i, func(elem []byte) (bool, error) {
+		if err := scanned(q, len(elem)); err != nil {
+			return false, err
+		}
+		pos := tPosition{n, length}
+		n++
+		return filterMatch(q, elem, f.toks, pos)
+	}, res)
+}
+
+// matchElements appends array elements accepted by match to res
+func matchElements(input []byte, i int, match func(elem []byte) (bool, error), res [][]byte) ([][]byte, error) {
+	l := len(input)
+	// fullscan
+	for i < l && input[i] != ']' {
+		e, err := skipValue(input, i)
+		if err != nil {
+			return nil, err
+		}
+		b, err := match(input[i:e])
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			res = append(res, input[i:e])
+		}
+		// skip spaces after value
+		i, err = skipSpaces(input, e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// sliceStep returns the step of a slice, 1 if not specified
+func sliceStep(step int) int {
+	if step == 0 {
+		return 1
+	}
+	return step
+}
+
+// stepped reports whether the node is a single slice selecting other than every element in order
+func stepped(nod *tNode) bool {
+	return nod.Type&cArrayRanged > 0 && nod.Filter == nil && len(nod.Elems) == 0 && sliceStep(nod.Step) != 1
+}
+
+// upToFirst is the right bound of a reversed slice running through the first element
+const upToFirst = -maxInt - 1
+
+// reverseBounds converts the bounds of a reversed slice to the inclusive range of element positions, a >= b.
+// Out of range bounds are an error unless clamped.
+func reverseBounds(left int, right int, n int, clamp bool) (int, int, error) {
+	a := left
+	if a < 0 {
+		a += n
+	}
+	b := 0
+	if right != upToFirst {
+		b = right
+		if b < 0 {
+			b += n
+		}
+		b++ // right bound excluded
+	}
+	if clamp || n == 0 {
+		if a >= n {
+			a = n - 1
+		}
+		if b < 0 {
+			b = 0
+		}
+		return a, b, nil // nothing is selected if a < b
+	}
+	if a < 0 || a >= n || b < 0 || b > n {
+		return 0, 0, ErrArrayElementNotFound
+	}
+	return a, b, nil
+}
+
+// adjustBounds converts slice bounds to the inclusive range of element positions.
+// Out of range bounds are an error unless clamped.
+func adjustBounds(left int, right int, n int, clamp bool) (int, int, error) {
 	a := left
 	b := right
 	if b == 0 {
@@ -786,8 +2465,17 @@ func adjustBounds(left int, right int, n int) (int, int, error) {
 		b += n
 	}
 	b-- // right bound excluded
-	if n > 0 && (a < 0 || a >= n || b < 0 || b >= n) {
-		return 0, 0, errArrayElementNotFound
+	if clamp || n == 0 {
+		if a < 0 {
+			a = 0
+		}
+		if b >= n {
+			b = n - 1
+		}
+		return a, b, nil // nothing is selected if a > b
+	}
+	if a < 0 || a >= n || b < 0 || b >= n {
+		return 0, 0, ErrArrayElementNotFound
 	}
 	return a, b, nil
 }
@@ -825,8 +2513,8 @@ func skipValue(input []byte, i int) (int, error) {
 		// object or array
 		return skipObject(input, i)
 	} else {
-		if (input[i] >= '0' && input[i] <= '9') || input[i] == '-' || input[i] == '.' {
-			// number
+		if (input[i] >= '0' && input[i] <= '9') || input[i] == '-' || input[i] == '.' || input[i] == '+' {
+			// number (a leading '+' is tolerated here, Validate rejects it)
 			i = skipNumber(input, i)
 		} else {
 			// bool, null
@@ -841,9 +2529,16 @@ func skipValue(input []byte, i int) (int, error) {
 
 func skipNumber(input []byte, i int) int {
 	l := len(input)
+	s := i
 	for ; i < l; i++ {
 		ch := input[i]
-		if !((ch >= '0' && ch <= '9') || ch == '.' || ch == '-' || ch == 'E' || ch == 'e') {
+		if ch == '+' || ch == '-' {
+			if i == s || input[i-1] == 'e' || input[i-1] == 'E' {
+				continue // leading or exponent sign
+			}
+			break
+		}
+		if !((ch >= '0' && ch <= '9') || ch == '.' || ch == 'E' || ch == 'e') {
 			break
 		}
 	}
@@ -884,6 +2579,15 @@ func checkValueType(input []byte, nod *tNode) error {
 		return nil
 	}
 	ch := input[0]
+	if nod.Type&(cDeep|cArrayType) == cDeep {
+		return nil // deep scan descends into any value
+	}
+	if ch == '[' && nod.Next != nil && isWildcard(nod.Next) {
+		return nil // wildcard matches array elements as well
+	}
+	if ch == '[' && nod.Type&cArrayType == 0 && indexesArray(nod.Next) {
+		return nil // $['key'][0] or $['a','b'][0]
+	}
 	if nod.Type&cArrayType == 0 && ch != '{' {
 		return errObjectExpected
 	} else if nod.Type&cArrayType > 0 && ch != '[' {
@@ -892,30 +2596,36 @@ func checkValueType(input []byte, nod *tNode) error {
 	return nil
 }
 
-func doFunc(input []byte, nod *tNode) ([]byte, error) {
+// indexesArray reports whether the node is a bare array step like [0] following a bracketed key
+func indexesArray(nod *tNode) bool {
+	return nod != nil && nod.Type&cArrayType > 0 && len(nod.Key) == 0 && len(nod.Keys) == 0
+}
+
+func doFunc(q *tQuery, input []byte, nod *tNode) ([]byte, error) {
 	var err error
 	var result int
+	if bytes.EqualFold(word("nth"), nod.Key) || bytes.EqualFold(word("first"), nod.Key) || bytes.EqualFold(word("last"), nod.Key) {
+		return sliceArray(q, input, nod)
+	}
+	if fn, ok := registeredFunc(nod.Key); ok {
+		e, err := skipValue(input, 0)
+		if err != nil {
+			return nil, err
+		}
+		return fn(input[:e])
+	}
+	if aggregateFunc(nod.Key) {
+		return aggregate(input, nod.Key)
+	}
 	if bytes.Equal(word("size"), nod.Key) {
 		result, err = skipValue(input, 0)
 	} else if bytes.Equal(word("length"), nod.Key) || bytes.Equal(word("count"), nod.Key) {
 		if input[0] == '"' {
 			result, err = skipString(input, 0)
 		} else if input[0] == '[' {
-			i := 1
-			l := len(input)
-			// count elements
-			for i < l && input[i] != ']' {
-				e, err := skipValue(input, i)
-				if err != nil {
-					return nil, err
-				}
-				result++
-				// skip spaces after value
-				i, err = skipSpaces(input, e)
-				if err != nil {
-					return nil, err
-				}
-			}
+			result, err = countElements(input, 1)
+		} else if input[0] == '{' {
+			result, err = countMembers(input)
 		} else {
 			return nil, errInvalidLengthUsage
 		}
@@ -926,23 +2636,87 @@ func doFunc(input []byte, nod *tNode) ([]byte, error) {
 	return []byte(strconv.Itoa(result)), nil
 }
 
-func readInt(path []byte, i int) (int, int) {
+// aggregateFunc reports whether the function is one of the numeric aggregates: min, max, sum, avg
+func aggregateFunc(name []byte) bool {
+	switch strings.ToLower(string(name)) {
+	case "min", "max", "sum", "avg":
+		return true
+	}
+	return false
+}
+
+// aggregate applies a numeric aggregate function to the elements of an array. Any element other than a number
+// is an error, so is a sum out of the float64 range. min and max return the element as is,
+// min, max and avg of an empty array are null, its sum is 0.
+func aggregate(input []byte, function []byte) ([]byte, error) {
+	elems, err := arrayValues(input)
+	if err != nil {
+		return nil, err
+	}
+	fn := strings.ToLower(string(function))
+	if len(elems) == 0 {
+		if fn == "sum" {
+			return []byte("0"), nil
+		}
+		return []byte("null"), nil
+	}
+	sum := 0.0
+	min, max := 0, 0
+	nums := make([]float64, len(elems))
+	for i, elem := range elems {
+		if elem[0] != '-' && (elem[0] < '0' || elem[0] > '9') {
+			return nil, errInvalidArithmetic
+		}
+		if nums[i], err = strconv.ParseFloat(string(elem), 64); err != nil {
+			return nil, errInvalidArithmetic
+		}
+		sum += nums[i]
+		if nums[i] < nums[min] {
+			min = i
+		}
+		if nums[i] > nums[max] {
+			max = i
+		}
+	}
+	switch fn {
+	case "min":
+		return elems[min], nil
+	case "max":
+		return elems[max], nil
+	}
+	if math.IsInf(sum, 0) {
+		return nil, errInvalidArithmetic
+	}
+	if fn == "avg" {
+		sum /= float64(len(elems))
+	}
+	return appendNumber(nil, strconv.AppendFloat(nil, sum, 'g', -1, 64)), nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+func readInt(path []byte, i int) (int, int, error) {
 	sign := 1
 	l := len(path)
 	if i >= l {
-		return 0, i
+		return 0, i, nil
 	}
+	s := i
 	ind := 0
 	for i < l && (path[i] == '-' || (path[i] >= '0' && path[i] <= '9')) {
 		ch := path[i]
 		if ch == '-' {
 			sign = -1
 		} else {
-			ind = ind*10 + int(ch-'0')
+			d := int(ch - '0')
+			if ind > (maxInt-d)/10 {
+				return 0, s, errPathIndexOverflow
+			}
+			ind = ind*10 + d
 		}
 		i++
 	}
-	return ind * sign, i
+	return ind * sign, i, nil
 }
 
 func skipSpaces(input []byte, i int) (int, error) {
@@ -960,22 +2734,20 @@ func skipSpaces(input []byte, i int) (int, error) {
 
 func skipString(input []byte, i int) (int, error) {
 	bound := input[i]
-	prev := bound
-	done := false
 	i++
 	l := len(input)
-	for i < l && !done {
+	for i < l {
 		ch := input[i]
-		if ch == bound && prev != '\\' {
-			done = true
+		if ch == '\\' {
+			i += 2 // escaped char
+			continue
 		}
-		prev = ch
 		i++
+		if ch == bound {
+			return i, nil
+		}
 	}
-	if i == l && !done {
-		return 0, errUnexpectedEnd
-	}
-	return i, nil
+	return 0, errUnexpectedEnd
 }
 
 func skipObject(input []byte, i int) (int, error) {
@@ -984,14 +2756,13 @@ func skipObject(input []byte, i int) (int, error) {
 	unmark := mark + 2 // ] or }
 	nested := 0
 	instr := false
-	prev := mark
 	i++
 	for i < l && !(input[i] == unmark && nested == 0 && !instr) {
 		ch := input[i]
 		if ch == '"' {
-			if prev != '\\' {
-				instr = !instr
-			}
+			instr = !instr
+		} else if instr && ch == '\\' {
+			i++ // escaped char
 		} else if !instr {
 			if ch == mark {
 				nested++
@@ -999,10 +2770,9 @@ func skipObject(input []byte, i int) (int, error) {
 				nested--
 			}
 		}
-		prev = ch
 		i++
 	}
-	if i == l {
+	if i >= l {
 		return 0, errUnexpectedEnd
 	}
 	i++ // closing mark
@@ -1021,6 +2791,26 @@ func repool(node *tNode) {
 	}
 }
 
+// valueType returns the JSON type of a value: object, array, string, number, boolean or null
+func valueType(input []byte) string {
+	if len(input) == 0 {
+		return "null"
+	}
+	switch input[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
 func looksLikeJSON(input []byte) error {
 	if len(input) == 0 {
 		return errUnexpectedEnd
@@ -0,0 +1,171 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import "bytes"
+
+// GetAllowed is Get for a jsonpath coming from an untrusted source: the query is only run if jsonpath
+// stays within one of the allowed patterns, all the jsonpaths of its filters included.
+// A pattern is a jsonpath allowing the values it matches along with everything beneath them.
+// A wildcard of a pattern stands for any key ($.public.*) or any array selector ($.items[*]),
+// any other step must be spelled the same way in jsonpath, bracket notation aside:
+// $.public.* allows $.public.name and $.public['a','b'][0], but neither $.public nor $.*, $..name or $.secret.
+func GetAllowed(input []byte, path string, allowed []string) ([]byte, error) {
+
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer repool(node)
+
+	patterns := make([]*tNode, 0, len(allowed))
+	defer func() {
+		for _, pattern := range patterns {
+			repool(pattern)
+		}
+	}()
+	for _, pat := range allowed {
+		pattern, err := compilePath(pat, nil)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	if !allowedPath(node, patterns) {
+		return nil, errPathNotAllowed
+	}
+
+	q := newQuery(input)
+
+	return getValue(q, input, node)
+}
+
+// allowedPath reports whether the node chain stays within one of the patterns, the root references of its filters included
+func allowedPath(node *tNode, patterns []*tNode) bool {
+	allowed := false
+	for _, pattern := range patterns {
+		if allowed = withinPattern(node, pattern); allowed {
+			break
+		}
+	}
+	return allowed && allowedReferences(node, patterns)
+}
+
+// allowedReferences reports whether the filters of the node chain only refer to allowed values
+func allowedReferences(node *tNode, patterns []*tNode) bool {
+	for nod := node; nod != nil; nod = nod.Next {
+		if nod.Filter == nil {
+			continue
+		}
+		for _, tok := range nod.Filter.toks {
+			if tok.Operand == nil || tok.Operand.Node == nil {
+				continue
+			}
+			ref := tok.Operand.Node
+			if len(ref.Key) == 1 && ref.Key[0] == '$' {
+				if !allowedPath(ref, patterns) {
+					return false
+				}
+			} else if !allowedReferences(ref, patterns) {
+				return false // @.x[?($.y)]
+			}
+		}
+	}
+	return true
+}
+
+// withinPattern matches the node chain step by step against the pattern chain.
+// The steps beneath the last node of the pattern are not restricted.
+func withinPattern(nod *tNode, pattern *tNode) bool {
+	for pat := pattern; pat != nil; pat, nod = pat.Next, nod.Next {
+		if nod == nil || nod.Type&cFunction > 0 {
+			return false
+		}
+		if !keyWithin(nod, pat) {
+			return false
+		}
+		if pat.Next == nil {
+			return true // the array selector and deep scan of the node are beneath the pattern
+		}
+		if nod.Type&cDeep != pat.Type&cDeep || !arrayWithin(nod, pat) {
+			return false
+		}
+		if nod.Filter != nil && !filterWithin(nod.Filter, pat.Next) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterWithin reports whether the operands of a filter referring to the element (@) stay within the pattern of the element
+func filterWithin(f *tFilter, pattern *tNode) bool {
+	for _, tok := range f.toks {
+		if tok.Operand == nil || tok.Operand.Node == nil {
+			continue
+		}
+		ref := tok.Operand.Node
+		if ref.Key[0] != '@' {
+			continue // root references are checked by allowedReferences
+		}
+		if ref.Next == nil || ref.Type&(cArrayType|cDeep) > 0 || !withinPattern(ref.Next, pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// keyWithin reports whether the key step of the node is allowed by the key step of the pattern
+func keyWithin(nod *tNode, pat *tNode) bool {
+	keys := nod.Keys
+	if len(nod.Key) > 0 {
+		keys = []word{nod.Key}
+	}
+	if isWildcard(pat) {
+		return len(keys) > 0
+	}
+	allowed := pat.Keys
+	if len(pat.Key) > 0 {
+		allowed = []word{pat.Key}
+	}
+	if len(keys) == 0 || nod.Type&cGlob != pat.Type&cGlob || isWildcard(nod) {
+		return len(keys) == 0 && len(allowed) == 0
+	}
+	for _, key := range keys {
+		found := false
+		for _, a := range allowed {
+			if found = bytes.Equal(key, a); found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayWithin reports whether the array selector of the node is allowed by the array selector of the pattern
+func arrayWithin(nod *tNode, pat *tNode) bool {
+	if pat.Type&cArrayType == 0 || nod.Type&cArrayType == 0 {
+		return pat.Type&cArrayType == nod.Type&cArrayType
+	}
+	if pat.Filter == nil && len(pat.Elems) == 0 && pat.Type&cArrayRanged > 0 && pat.Left == 0 && pat.Right == 0 && sliceStep(pat.Step) == 1 {
+		return true // [*] or [:]
+	}
+	if pat.Filter != nil || nod.Filter != nil || len(pat.Elems) != len(nod.Elems) {
+		return false
+	}
+	for i := range pat.Elems {
+		if pat.Elems[i] != nod.Elems[i] {
+			return false
+		}
+	}
+	return pat.Type&cArrayRanged == nod.Type&cArrayRanged && pat.Left == nod.Left && pat.Right == nod.Right && pat.Step == nod.Step
+}
@@ -0,0 +1,67 @@
+package jsonslice
+
+import "testing"
+
+func Test_GetAllowed(t *testing.T) {
+
+	doc := []byte(`{"public":{"name":"x","tags":["a","b"],"items":[{"id":1},{"id":2}]},"secret":{"key":"s3cr3t","id":1},"items":[{"id":1,"pw":"p"}]}`)
+	allowed := []string{`$.public.*`, `$.items[*].id`}
+
+	tests := []struct {
+		Query    string
+		Expected string
+	}{
+		// allowed
+		{`$.public.name`, `"x"`},
+		{`$.public['name']`, `"x"`},
+		{`$.public.tags[0]`, `"a"`},
+		{`$.public.tags.length()`, `2`},
+		{`$.public['name','tags']`, `["x",["a","b"]]`},
+		{`$.public.*`, `["x",["a","b"],[{"id":1},{"id":2}]]`},
+		{`$.public.items[?(@.id > 1)].id`, `[2]`},
+		{`$.public.items[?(@.id == $.items[0].id)]`, `[{"id":1}]`},
+		{`$.public..id`, `path: not allowed`},
+		{`$.items[0].id`, `1`},
+		{`$.items[:].id`, `[1]`},
+		{`$.items[?(@.id)].id`, `[1]`},
+		// rejected
+		{`$.secret`, `path: not allowed`},
+		{`$.secret.key`, `path: not allowed`},
+		{`$.public`, `path: not allowed`},
+		{`$.public.length()`, `path: not allowed`},
+		{`$`, `path: not allowed`},
+		{`$.*`, `path: not allowed`},
+		{`$.*.key`, `path: not allowed`},
+		{`$..key`, `path: not allowed`},
+		{`$['public','secret']`, `path: not allowed`},
+		{`$.items[0]`, `path: not allowed`},
+		{`$.items[0].pw`, `path: not allowed`},
+		{`$.publ*.name`, `path: not allowed`},
+		{`$.public.items[?(@.id == $.secret.id)]`, `path: not allowed`},
+		{`$.public.name $.secret`, `path: unexpected text at 14`},
+		{`$.items[?(@.id == 1)].id`, `[1]`},
+		{`$.items[?(@.pw == 'p')].id`, `path: not allowed`},
+		{`$.items[?(@ == 'p')].id`, `path: not allowed`},
+		{`$.items[?(@..pw)].id`, `path: not allowed`},
+		{`$.public.items[?(@.x[?($.secret.id)])]`, `path: not allowed`},
+		// invalid jsonpath
+		{`$.public[`, `path: index bound missing at 9`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetAllowed(doc, tst.Query, allowed)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+
+	if _, err := GetAllowed(doc, `$.public.name`, []string{`public`}); err == nil {
+		t.Errorf("invalid pattern accepted")
+	}
+	if _, err := GetAllowed(doc, `$.public.name`, nil); err != errPathNotAllowed {
+		t.Errorf("empty allow list : unexpected %v", err)
+	}
+}
@@ -9,6 +9,12 @@ package jsonslice
   The result is also []byte.
 **/
 
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+)
+
 func init() {
 }
 
@@ -25,36 +31,109 @@ func GetArrayElements(input []byte, path string, alloc int) ([][]byte, error) {
 		return nil, errPathRootExpected
 	}
 
-	node, _, err := parsePath([]byte(path))
+	node, _, err := parsePath([]byte(path), false)
 	if err != nil {
 		return nil, err
 	}
 
-	n := node
-	for {
-		n = n.Next
-		if n == nil {
-			break
+	q := newQuery(input)
+
+	return getValueAE(q, input, node, alloc)
+}
+
+// GetColumn returns the value of field of every element of the array matching arrayPath, in the order of the elements.
+// The value is nil for the elements lacking field, those not being objects included.
+func GetColumn(input []byte, arrayPath, field string) ([][]byte, error) {
+	elems, err := arrayElements(input, arrayPath)
+	if err != nil {
+		return nil, err
+	}
+	return fieldValues(elems, field)
+}
+
+// GetInRange returns the elements of the array matching arrayPath having a number in field within [min,max],
+// or within (min,max) unless inclusive, merged into an array. The elements lacking field or having a value
+// other than a number in it are left out.
+func GetInRange(input []byte, arrayPath, field string, min, max float64, inclusive bool) ([]byte, error) {
+	return GetArrayFilterFunc(input, arrayPath, func(elem []byte) (bool, error) {
+		column, err := fieldValues([][]byte{elem}, field)
+		if err != nil {
+			return false, err
 		}
-		if n.Filter != nil {
-			for _, tok := range n.Filter.toks {
-				if tok.Operand != nil && tok.Operand.Node != nil && len(tok.Operand.Node.Key) == 1 && tok.Operand.Node.Key[0] == '$' {
-					val, err := getValue(input, tok.Operand.Node)
-					if err != nil {
-						// not found or other error
-						tok.Operand.Type = cOpNull
-					}
-					decodeValue(val, tok.Operand)
-					tok.Operand.Node = nil
-				}
-			}
+		val := column[0]
+		if val == nil || (val[0] != '-' && (val[0] < '0' || val[0] > '9')) {
+			return false, nil
 		}
+		f, err := strconv.ParseFloat(string(val), 64)
+		if err != nil {
+			return false, nil
+		}
+		if inclusive {
+			return f >= min && f <= max, nil
+		}
+		return f > min && f < max, nil
+	})
+}
+
+// UnmarshalEach decodes every element of the array matching arrayPath by json.Unmarshal into a new element of the slice
+// out points to. The slice is replaced, unless an error occurs: var users []User; err := UnmarshalEach(data, "$.users", &users)
+func UnmarshalEach(input []byte, arrayPath string, out interface{}) error {
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return errSlicePointerExpected
+	}
+	elems, err := arrayElements(input, arrayPath)
+	if err != nil {
+		return err
+	}
+	slice := reflect.MakeSlice(ptr.Elem().Type(), len(elems), len(elems))
+	for i, elem := range elems {
+		if err = json.Unmarshal(elem, slice.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	ptr.Elem().Set(slice)
+	return nil
+}
+
+// arrayElements returns the elements of the array matching jsonpath
+func arrayElements(input []byte, path string) ([][]byte, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return nil, err
 	}
+	if len(value) == 0 || value[0] != '[' {
+		return nil, errArrayExpected
+	}
+	return arrayValues(value)
+}
 
-	return getValueAE(input, node, alloc)
+// fieldValues returns the value of field of every element, nil for the elements lacking it
+func fieldValues(elems [][]byte, field string) ([][]byte, error) {
+	nod := &tNode{Key: word(field)}
+	q := newQuery(nil)
+	column := make([][]byte, len(elems))
+	for i, elem := range elems {
+		if elem[0] != '{' {
+			continue
+		}
+		val, err := seekKey(q, elem, nod, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			continue
+		}
+		e, err := skipValue(val, 0)
+		if err != nil {
+			return nil, err
+		}
+		column[i] = val[:e]
+	}
+	return column, nil
 }
 
-func getValueAE(input []byte, nod *tNode, alloc int) (result [][]byte, err error) {
+func getValueAE(q *tQuery, input []byte, nod *tNode, alloc int) (result [][]byte, err error) {
 
 	i, _ := skipSpaces(input, 0)
 
@@ -63,12 +142,15 @@ func getValueAE(input []byte, nod *tNode, alloc int) (result [][]byte, err error
 		return nil, err
 	}
 	// wildcard
-	if len(nod.Key) == 1 && nod.Key[0] == '*' {
+	if isWildcard(nod) {
 		return nil, errWildcardsNotSupported
 	}
 	if len(nod.Keys) > 0 || (len(nod.Key) > 0 && !bytein(nod.Key[0], []byte{'$', '@'})) {
 		// find the key and seek to the value
-		if input, err = getKeyValue(input, nod); err != nil {
+		if input[0] != '{' {
+			return nil, errObjectExpected
+		}
+		if input, err = getKeyValue(q, input, nod); err != nil {
 			return nil, err
 		}
 	}
@@ -86,21 +168,21 @@ func getValueAE(input []byte, nod *tNode, alloc int) (result [][]byte, err error
 		if nod.Type&cArrayType == 0 {
 			return nil, errTerminalNodeArray
 		}
-		return sliceArrayElements(input, nod, alloc)
+		return sliceArrayElements(q, input, nod, alloc)
 	}
 	if nod.Type&cArrayType > 0 {
 		if nod.Type&cAgg > 0 {
 			return nil, errSubslicingNotSupported
 		}
-		if input, err = sliceArray(input, nod); err != nil {
+		if input, err = sliceArray(q, input, nod); err != nil {
 			return nil, err
 		}
 	}
-	return getValueAE(input, nod.Next, alloc)
+	return getValueAE(q, input, nod.Next, alloc)
 }
 
 // sliceArrayElements returns a slice of array elements
-func sliceArrayElements(input []byte, nod *tNode, alloc int) ([][]byte, error) {
+func sliceArrayElements(q *tQuery, input []byte, nod *tNode, alloc int) ([][]byte, error) {
 	if input[0] != '[' {
 		return nil, errArrayExpected
 	}
@@ -110,7 +192,7 @@ func sliceArrayElements(input []byte, nod *tNode, alloc int) ([][]byte, error) {
 
 	if nod.Type&cArrayRanged == 0 && nod.Left >= 0 && len(nod.Elems) == 0 {
 		// single positive index -- easiest case
-		elem, err := getArrayElement(input, i, nod)
+		elem, err := getArrayElement(q, input, i, nod)
 		if err != nil {
 			return nil, err
 		}
@@ -128,8 +210,15 @@ func sliceArrayElements(input []byte, nod *tNode, alloc int) ([][]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(nod.Elems) > 0 {
-		for _, ii := range nod.Elems {
+	if err = scanned(q, arrayEnd(elems)); err != nil {
+		return nil, err
+	}
+	if len(nod.Elems) > 0 || stepped(nod) {
+		idx, err := elemIndexes(nod, len(elems))
+		if err != nil {
+			return nil, err
+		}
+		for _, ii := range idx {
 			res = append(res, input[elems[ii].start:elems[ii].end])
 		}
 		return res, nil
@@ -138,13 +227,13 @@ func sliceArrayElements(input []byte, nod *tNode, alloc int) ([][]byte, error) {
 	if nod.Type&cArrayRanged == 0 {
 		a := nod.Left + len(elems) // nod.Left is negative, so correct it to a real element index
 		if a < 0 {
-			return nil, errArrayElementNotFound
+			return nil, ErrArrayElementNotFound
 		}
 
 		return append(res, input[elems[a].start:elems[a].end]), nil
 	}
 	// two bounds
-	a, b, err := adjustBounds(nod.Left, nod.Right, len(elems))
+	a, b, err := adjustBounds(nod.Left, nod.Right, len(elems), nod.Type&cClamped > 0)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,101 @@
+package jsonslice
+
+import "testing"
+
+func Test_GetColumn(t *testing.T) {
+
+	doc := []byte(`{"rows":[{"id":1,"name":"a"},{"id":2},{"name":"c","id":3},5,{"name":{"first":"d"}}],"obj":{"id":1}}`)
+
+	column, err := GetColumn(doc, `$.rows`, "name")
+	expected := []string{`"a"`, "", `"c"`, "", `{"first":"d"}`}
+	if err != nil || len(column) != len(expected) {
+		t.Fatalf("$.rows : unexpected %q (%v)", column, err)
+	}
+	for i, val := range column {
+		if string(val) != expected[i] || (expected[i] == "") != (val == nil) {
+			t.Errorf("$.rows [%d] : expected `%s` but got `%s`", i, expected[i], val)
+		}
+	}
+
+	column, err = GetColumn(doc, `$.rows[?(@.id > 1)]`, "id")
+	if err != nil || len(column) != 2 || string(column[0]) != "2" || string(column[1]) != "3" {
+		t.Errorf("$.rows[?(@.id > 1)] : unexpected %q (%v)", column, err)
+	}
+
+	if _, err = GetColumn(doc, `$.obj`, "id"); err != errArrayExpected {
+		t.Errorf("$.obj : unexpected error %v", err)
+	}
+	if _, err = GetColumn(doc, `$.missing`, "id"); err == nil {
+		t.Errorf("$.missing : error expected")
+	}
+}
+
+func Test_GetInRange(t *testing.T) {
+
+	doc := []byte(`{"items":[{"id":1,"price":5},{"id":2,"price":10},{"id":3,"price":15.5},{"id":4,"price":20},{"id":5,"price":"15"},{"id":6},25],"obj":{}}`)
+
+	tests := []struct {
+		Min, Max  float64
+		Inclusive bool
+		Expected  string
+	}{
+		{10, 20, true, `[{"id":2,"price":10},{"id":3,"price":15.5},{"id":4,"price":20}]`},
+		{10, 20, false, `[{"id":3,"price":15.5}]`},
+		{0, 4, true, `[]`},
+		{-1e9, 1e9, false, `[{"id":1,"price":5},{"id":2,"price":10},{"id":3,"price":15.5},{"id":4,"price":20}]`},
+		{20, 10, true, `[]`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetInRange(doc, `$.items`, "price", tst.Min, tst.Max, tst.Inclusive)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf("%v..%v (%v)\n\texpected `"+tst.Expected+"`\n\tbut got  `"+string(res)+"`", tst.Min, tst.Max, tst.Inclusive)
+		}
+	}
+
+	if _, err := GetInRange(doc, `$.obj`, "price", 0, 1, true); err == nil {
+		t.Errorf("$.obj : error expected")
+	}
+}
+
+func Test_UnmarshalEach(t *testing.T) {
+
+	doc := []byte(`{"users":[{"name":"ann","age":30,"tags":["a"]},{"name":"bob","age":25},{"name":"eve","age":41,"extra":true}],"obj":{},"bad":[{"age":"x"}]}`)
+
+	type user struct {
+		Name string   `json:"name"`
+		Age  int      `json:"age"`
+		Tags []string `json:"tags"`
+	}
+
+	users := []user{{Name: "stale"}}
+	if err := UnmarshalEach(doc, `$.users`, &users); err != nil {
+		t.Fatalf("$.users : unexpected error %v", err)
+	}
+	if len(users) != 3 || users[0].Name != "ann" || users[0].Tags[0] != "a" || users[1].Age != 25 || users[2].Name != "eve" {
+		t.Errorf("$.users : unexpected %+v", users)
+	}
+
+	var ages []int
+	if err := UnmarshalEach(doc, `$.users[?(@.age > 28)].age`, &ages); err != nil || len(ages) != 2 || ages[0] != 30 || ages[1] != 41 {
+		t.Errorf("$.users[?(@.age > 28)].age : unexpected %v (%v)", ages, err)
+	}
+
+	var none []user
+	if err := UnmarshalEach(doc, `$.users[?(@.age > 99)]`, &none); err != nil || none == nil || len(none) != 0 {
+		t.Errorf("$.users[?(@.age > 99)] : unexpected %v (%v)", none, err)
+	}
+
+	if err := UnmarshalEach(doc, `$.users`, users); err != errSlicePointerExpected {
+		t.Errorf("not a pointer : unexpected error %v", err)
+	}
+	if err := UnmarshalEach(doc, `$.obj`, &users); err != errArrayExpected {
+		t.Errorf("$.obj : unexpected error %v", err)
+	}
+	if err := UnmarshalEach(doc, `$.bad`, &users); err == nil {
+		t.Errorf("$.bad : error expected")
+	}
+}
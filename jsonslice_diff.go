@@ -0,0 +1,147 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// ChangedPaths compares two json documents and returns the canonical jsonpaths (see Walk)
+// of the values added, removed or changed in b. Objects are compared by keys and arrays by positions,
+// so key order and whitespace do not matter; numbers are compared by value.
+func ChangedPaths(a, b []byte) ([]string, error) {
+	va, err := rootValue(a)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := rootValue(b)
+	if err != nil {
+		return nil, err
+	}
+	path := make([]byte, 1, 64)
+	path[0] = '$'
+	return diffValues(va, vb, path, []string{})
+}
+
+// diffValues appends the paths of the differences between a and b to changed
+func diffValues(a, b []byte, path []byte, changed []string) ([]string, error) {
+	if valueType(a) != valueType(b) {
+		return append(changed, string(path)), nil
+	}
+	switch a[0] {
+	case '{':
+		return diffObjects(a, b, path, changed)
+	case '[':
+		return diffArrays(a, b, path, changed)
+	}
+	if !equalScalars(a, b) {
+		changed = append(changed, string(path))
+	}
+	return changed, nil
+}
+
+func diffObjects(a, b []byte, path []byte, changed []string) ([]string, error) {
+	keysA, valsA, err := objectMembers(a)
+	if err != nil {
+		return nil, err
+	}
+	keysB, valsB, err := objectMembers(b)
+	if err != nil {
+		return nil, err
+	}
+	inB := make(map[string]int, len(keysB))
+	for i, key := range keysB {
+		inB[string(key)] = i
+	}
+	inA := make(map[string]bool, len(keysA))
+	for i, key := range keysA {
+		inA[string(key)] = true
+		j, ok := inB[string(key)]
+		if !ok {
+			changed = append(changed, string(appendKey(path, key))) // removed
+			continue
+		}
+		if changed, err = diffValues(valsA[i], valsB[j], appendKey(path, key), changed); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range keysB {
+		if !inA[string(key)] {
+			changed = append(changed, string(appendKey(path, key))) // added
+		}
+	}
+	return changed, nil
+}
+
+func diffArrays(a, b []byte, path []byte, changed []string) ([]string, error) {
+	elemsA, err := arrayScan(a)
+	if err != nil {
+		return nil, err
+	}
+	elemsB, err := arrayScan(b)
+	if err != nil {
+		return nil, err
+	}
+	for n := 0; n < len(elemsA) || n < len(elemsB); n++ {
+		if n >= len(elemsA) || n >= len(elemsB) {
+			changed = append(changed, string(appendIndex(path, n))) // added or removed
+			continue
+		}
+		ea, eb := elemsA[n], elemsB[n]
+		if changed, err = diffValues(a[ea.start:ea.end], b[eb.start:eb.end], appendIndex(path, n), changed); err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
+
+// objectMembers returns the keys and the values of an object
+func objectMembers(input []byte) ([][]byte, [][]byte, error) {
+	var keys, vals [][]byte
+	i, err := skipSpaces(input, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	for input[i] != '}' {
+		if input[i] != '"' {
+			return nil, nil, errKeyExpected
+		}
+		e, err := skipString(input, i)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := input[i+1 : e-1]
+		if i, err = seekToValue(input, e); err != nil {
+			return nil, nil, err
+		}
+		if e, err = skipValue(input, i); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		vals = append(vals, input[i:e])
+		if i, err = skipSpaces(input, e); err != nil {
+			return nil, nil, err
+		}
+	}
+	return keys, vals, nil
+}
+
+// equalScalars compares two values of the same type, numbers are compared by value
+func equalScalars(a, b []byte) bool {
+	if valueType(a) == "number" {
+		fa, errA := strconv.ParseFloat(string(a), 64)
+		fb, errB := strconv.ParseFloat(string(b), 64)
+		if errA == nil && errB == nil {
+			return fa == fb
+		}
+	}
+	return bytes.Equal(a, b)
+}
@@ -0,0 +1,41 @@
+package jsonslice
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_ChangedPaths(t *testing.T) {
+
+	a := []byte(`{"name": "svc", "limits": {"cpu": 1, "mem": "1G"}, "ports": [80, 443], "debug": false, "tags": ["x"]}`)
+	b := []byte(`{ "tags": ["x"], "ports": [80, 8443], "name": "svc", "limits": {"mem": "1G", "cpu": 2.0},
+		"my key": null, "debug": false }`)
+
+	tests := []struct {
+		A, B     []byte
+		Expected []string
+	}{
+		// one nested field and one array element changed, one key added
+		{a, b, []string{`$.limits.cpu`, `$.ports[1]`, `$['my key']`}},
+		{b, a, []string{`$.ports[1]`, `$.limits.cpu`, `$['my key']`}},
+		// same values written differently
+		{a, []byte(`{"tags":["x"],"debug":false,"ports":[80,443.0],"limits":{"mem":"1G","cpu":1e0},"name":"svc"}`), []string{}},
+		// removed elements and type changes
+		{[]byte(`[1, [2, 3], {"a": 1}]`), []byte(`[1, [2]]`), []string{`$[1][1]`, `$[2]`}},
+		{[]byte(`{"a": {"b": 1}}`), []byte(`{"a": [1]}`), []string{`$.a`}},
+		{[]byte(`"x"`), []byte(`"x"`), []string{}},
+	}
+
+	for _, tst := range tests {
+		res, err := ChangedPaths(tst.A, tst.B)
+		if err != nil {
+			t.Errorf("ChangedPaths : " + err.Error())
+		} else if fmt.Sprint(res) != fmt.Sprint(tst.Expected) {
+			t.Errorf("ChangedPaths %s\n\texpected `%v`\n\tbut got  `%v`", tst.A, tst.Expected, res)
+		}
+	}
+
+	if _, err := ChangedPaths(a, []byte(`{"a": [1, 2}`)); err == nil {
+		t.Errorf("ChangedPaths : error expected")
+	}
+}
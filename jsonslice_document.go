@@ -0,0 +1,108 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import "sort"
+
+// Document is a json document accumulating edits: values are replaced by Set
+// and the edited document is serialized at once by Bytes. Jsonpaths always refer to the original input.
+type Document struct {
+	input []byte
+	edits []tEdit
+}
+
+// tEdit is a pending replacement of input[start:end]
+type tEdit struct {
+	start int
+	end   int
+	value []byte
+}
+
+// Index validates input and returns a document handle for it. Input is not copied and must not be modified.
+func Index(input []byte) (*Document, error) {
+	if err := Validate(input); err != nil {
+		return nil, err
+	}
+	return &Document{input: input}, nil
+}
+
+// Get returns a part of the original input matching jsonpath, pending edits are not seen
+func (d *Document) Get(path string) ([]byte, error) {
+	return Get(d.input, path)
+}
+
+// Set records the replacement of every value matching jsonpath by value, which is inserted as is.
+// Only existing values can be replaced. An edit overlapping a pending one, or a value nested within another one
+// matched, is rejected; a value matched more than once is replaced once.
+func (d *Document) Set(path string, value []byte) error {
+	spans, err := GetSpans(d.input, path)
+	if isNotFound(err) || (err == nil && len(spans) == 0) {
+		return ErrFieldNotFound
+	}
+	if err != nil {
+		return err
+	}
+	spans, err = editSpans(spans)
+	if err != nil {
+		return err
+	}
+	for _, span := range spans {
+		for _, edit := range d.edits {
+			if span[0] < edit.end && edit.start < span[1] {
+				return errOverlappingEdit
+			}
+		}
+	}
+	for _, span := range spans {
+		d.edits = append(d.edits, tEdit{span[0], span[1], value})
+	}
+	return nil
+}
+
+// editSpans sorts the spans matched by a single jsonpath and drops the repeated ones ($.a[0,0]).
+// A value nested within another one matched ($..x) is rejected as an overlap.
+func editSpans(spans [][2]int) ([][2]int, error) {
+	sorted := make([][2]int, len(spans))
+	copy(sorted, spans)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+	res := sorted[:0]
+	for _, span := range sorted {
+		if len(res) > 0 {
+			last := res[len(res)-1]
+			if span == last {
+				continue
+			}
+			if span[0] < last[1] {
+				return nil, errOverlappingEdit
+			}
+		}
+		res = append(res, span)
+	}
+	return res, nil
+}
+
+// Bytes returns the document with all pending edits applied. The original input is not modified.
+func (d *Document) Bytes() []byte {
+	if len(d.edits) == 0 {
+		return d.input
+	}
+	sort.Slice(d.edits, func(i, j int) bool { return d.edits[i].start < d.edits[j].start })
+	size := len(d.input)
+	for _, edit := range d.edits {
+		size += len(edit.value) - (edit.end - edit.start)
+	}
+	res := make([]byte, 0, size)
+	prev := 0
+	for _, edit := range d.edits {
+		res = append(append(res, d.input[prev:edit.start]...), edit.value...)
+		prev = edit.end
+	}
+	return append(res, d.input[prev:]...)
+}
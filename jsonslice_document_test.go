@@ -0,0 +1,71 @@
+package jsonslice
+
+import "testing"
+
+func Test_Document(t *testing.T) {
+
+	const original = `{"a":1,"b":[{"c":"x"},{"c":"y"}],"d":{"e":true}}`
+	input := []byte(original)
+
+	doc, err := Index(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the edits are applied in document order whatever order they are made in
+	edits := [][2]string{
+		{`$.d.e`, `false`},
+		{`$.a`, `{"n":2}`},
+		{`$.b[*].c`, `null`},
+	}
+	for _, edit := range edits {
+		if err := doc.Set(edit[0], []byte(edit[1])); err != nil {
+			t.Errorf(edit[0]+" : unexpected error %v", err)
+		}
+	}
+	// jsonpaths refer to the original input
+	if res, err := doc.Get(`$.a`); err != nil || string(res) != `1` {
+		t.Errorf("$.a : unexpected %s (%v)", res, err)
+	}
+
+	expected := `{"a":{"n":2},"b":[{"c":null},{"c":null}],"d":{"e":false}}`
+	if res := doc.Bytes(); string(res) != expected {
+		t.Errorf("Bytes()\n\texpected `%s`\n\tbut got  `%s`", expected, res)
+	}
+	if string(doc.Bytes()) != expected {
+		t.Errorf("Bytes() : not repeatable")
+	}
+	if string(input) != original {
+		t.Errorf("input modified: %s", input)
+	}
+
+	// a value being edited already, entirely or in part
+	for _, path := range []string{`$.b`, `$.d`, `$.b[1].c`} {
+		if err := doc.Set(path, []byte(`0`)); err != errOverlappingEdit {
+			t.Errorf(path+" : expected error %v, got %v", errOverlappingEdit, err)
+		}
+	}
+	for _, path := range []string{`$.missing`, `$.b[5]`} {
+		if err := doc.Set(path, []byte(`0`)); !isNotFound(err) {
+			t.Errorf(path+" : not found expected, got %v", err)
+		}
+	}
+	if string(doc.Bytes()) != expected {
+		t.Errorf("Bytes() : rejected edits applied")
+	}
+
+	// the values matched by a single jsonpath
+	doc, _ = Index([]byte(`{"a":[1,2],"x":{"x":1}}`))
+	if err := doc.Set(`$..x`, []byte(`0`)); err != errOverlappingEdit {
+		t.Errorf("$..x : expected error %v, got %v", errOverlappingEdit, err)
+	}
+	if err := doc.Set(`$.a[0,0]`, []byte(`0`)); err != nil {
+		t.Errorf("$.a[0,0] : unexpected error %v", err)
+	}
+	if res := doc.Bytes(); string(res) != `{"a":[0,2],"x":{"x":1}}` {
+		t.Errorf("Bytes() : unexpected `%s`", res)
+	}
+
+	if _, err := Index([]byte(`{"a":`)); err == nil {
+		t.Errorf("Index : invalid input accepted")
+	}
+}
@@ -0,0 +1,99 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ExplainPath parses jsonpath and describes its steps in a human-readable form, e.g.
+// $.store.book[0:2].title -> key 'store' → key 'book' → slice [0:2] → key 'title'
+func ExplainPath(path string) (string, error) {
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return "", err
+	}
+	var steps []string
+	for nod := node; nod != nil; nod = nod.Next {
+		steps = explainNode(nod, steps)
+	}
+	repool(node)
+	if len(steps) == 0 {
+		return "root", nil
+	}
+	return strings.Join(steps, " → "), nil
+}
+
+// explainNode appends the steps of a single node: key, array selector, deep scan
+func explainNode(nod *tNode, steps []string) []string {
+	switch {
+	case nod.Type&cFunction > 0:
+		steps = append(steps, "function "+string(nod.Key)+"("+string(nod.Arg)+")")
+	case isWildcard(nod):
+		steps = append(steps, "wildcard")
+	case nod.Type&cGlob > 0:
+		steps = append(steps, "keys matching '"+string(nod.Key)+"'")
+	case len(nod.Keys) == 1:
+		steps = append(steps, "key '"+string(nod.Keys[0])+"'")
+	case len(nod.Keys) > 0:
+		keys := make([]string, len(nod.Keys))
+		for i, key := range nod.Keys {
+			keys[i] = "'" + string(key) + "'"
+		}
+		steps = append(steps, "keys "+strings.Join(keys, ","))
+	case len(nod.Key) > 0 && nod.Key[0] != '$' && nod.Key[0] != '@':
+		steps = append(steps, "key '"+string(nod.Key)+"'")
+	}
+	if nod.Type&cArrayType > 0 {
+		steps = append(steps, explainArray(nod))
+	}
+	if nod.Type&cDeep > 0 {
+		steps = append(steps, "deep scan")
+	}
+	return steps
+}
+
+func explainArray(nod *tNode) string {
+	if nod.Filter != nil {
+		return "filter [?(" + string(nod.Filter.src) + ")]"
+	}
+	if nod.Type&cArrayRanged == 0 {
+		return "index [" + strconv.Itoa(nod.Left) + "]"
+	}
+	if len(nod.Elems) > 0 {
+		elems := make([]string, len(nod.Elems))
+		for i, el := range nod.Elems {
+			elems[i] = strconv.Itoa(el.Left)
+			if el.Ranged {
+				elems[i] = explainSlice(el.Left, el.Right, el.Step)
+			}
+		}
+		return "indexes [" + strings.Join(elems, ",") + "]"
+	}
+	return "slice [" + explainSlice(nod.Left, nod.Right, nod.Step) + "]"
+}
+
+// explainSlice prints the bounds of a slice, omitting the ones a reversed slice runs through by default
+// (the last element on the left, the first one on the right)
+func explainSlice(left, right, step int) string {
+	l := strconv.Itoa(left)
+	if step < 0 && left == -1 {
+		l = ""
+	}
+	r := ""
+	if right != 0 && right != upToFirst {
+		r = strconv.Itoa(right)
+	}
+	if sliceStep(step) != 1 {
+		r += ":" + strconv.Itoa(step)
+	}
+	return l + ":" + r
+}
@@ -0,0 +1,35 @@
+package jsonslice
+
+import "testing"
+
+func Test_ExplainPath(t *testing.T) {
+
+	tests := []struct {
+		Query    string
+		Expected string
+	}{
+		{`$`, `root`},
+		{`$.store.book[0:2].title`, `key 'store' → key 'book' → slice [0:2] → key 'title'`},
+		{`$.store.book[?(@.price > 10)][1:].title`, `key 'store' → key 'book' → filter [?(@.price > 10)] → slice [1:] → key 'title'`},
+		{`$[-1]['a','b']`, `index [-1] → keys 'a','b'`},
+		{`$.a[1,3]`, `key 'a' → indexes [1,3]`},
+		{`$.a[::-1]`, `key 'a' → slice [::-1]`},
+		{`$.a[3::-2]`, `key 'a' → slice [3::-2]`},
+		{`$.a[:1:-1]`, `key 'a' → slice [:1:-1]`},
+		{`$.a[0,::-1]`, `key 'a' → indexes [0,::-1]`},
+		{`$['my key']`, `key 'my key'`},
+		{`$.data.user_*[0]`, `key 'data' → keys matching 'user_*' → index [0]`},
+		{`$..book.*.length()`, `deep scan → key 'book' → wildcard → function length()`},
+		{`$.store(`, `path: invalid element reference at 7`},
+	}
+
+	for _, tst := range tests {
+		res, err := ExplainPath(tst.Query)
+		if err != nil {
+			res = err.Error()
+		}
+		if res != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + res + "`")
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import "strings"
+
+// fallbacks splits a jsonpath at the top level ?? operators (not within brackets or quotes)
+// and returns the start and end offsets of every alternative. A single alternative means there is no fallback.
+func fallbacks(path string) [][2]int {
+	var alts [][2]int
+	bpath := []byte(path)
+	depth, start := 0, 0
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '\'', '"':
+			e, err := skipString(bpath, i)
+			if err != nil {
+				return nil // unterminated, left to the jsonpath parser
+			}
+			i = e - 1
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case '?':
+			if depth == 0 && i+1 < len(path) && path[i+1] == '?' {
+				alts = append(alts, [2]int{start, i})
+				start = i + 2
+				i++
+			}
+		}
+	}
+	return append(alts, [2]int{start, len(path)})
+}
+
+// getFallback returns the value of the first of the alternatives found. Like Lookup, a value of another type
+// on the way counts as not found and falls through to the next alternative, any other error is returned immediately.
+// An alternative other than a jsonpath is a literal: a string in single or double quotes, a number, true, false or null,
+// it is returned as json value. Every alternative is parsed beforehand, so a syntax error is reported even if it is never reached.
+func getFallback(input []byte, path string, alts [][2]int, opts *Options) ([]byte, error) {
+	nodes, literal, err := compileFallbacks(path, alts, opts)
+	defer repoolAll(nodes)
+	if err != nil {
+		return nil, err
+	}
+	return fallbackValue(nodes, literal, func(node *tNode) ([]byte, error) {
+		return evaluate(input, node, opts)
+	})
+}
+
+// fallbackValue returns the value of the first of the compiled alternatives found by eval, or the literal if there is one
+func fallbackValue(nodes []*tNode, literal []byte, eval func(node *tNode) ([]byte, error)) ([]byte, error) {
+	var err error
+	for _, node := range nodes {
+		var result []byte
+		result, err = eval(node)
+		if err == nil {
+			return result, nil
+		}
+		if !isNotFound(err) && !isTypeMismatch(err) {
+			return nil, err
+		}
+	}
+	if literal != nil {
+		return literal, nil
+	}
+	return nil, err
+}
+
+// compileFallbacks parses the alternatives of a fallback chain up to the first literal, which is returned as json value.
+// The alternatives after the literal are never reached, they are only checked.
+func compileFallbacks(path string, alts [][2]int, opts *Options) ([]*tNode, []byte, error) {
+	var nodes []*tNode
+	var literal []byte
+	for _, alt := range alts {
+		expr := strings.Trim(path[alt[0]:alt[1]], pathSpace)
+		if len(expr) > 0 && isLiteral(expr) {
+			value, err := fallbackLiteral(expr, path, alt[0]+strings.Index(path[alt[0]:], expr))
+			if err != nil {
+				return nodes, nil, err
+			}
+			if literal == nil {
+				literal = value
+			}
+			continue
+		}
+		// padded to keep the error positions within the whole jsonpath
+		node, err := compilePath(strings.Repeat(" ", alt[0])+path[alt[0]:alt[1]], opts)
+		if err != nil {
+			return nodes, nil, withinChain(err, path)
+		}
+		if literal != nil {
+			repool(node)
+		} else {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, literal, nil
+}
+
+// repoolAll returns the node chains back to the pool
+func repoolAll(nodes []*tNode) {
+	for _, node := range nodes {
+		repool(node)
+	}
+}
+
+// isLiteral reports whether a fallback alternative is a literal value rather than a jsonpath
+func isLiteral(expr string) bool {
+	ch := expr[0]
+	return ch == '\'' || ch == '"' || ch == '-' || (ch >= '0' && ch <= '9') ||
+		expr == "true" || expr == "false" || expr == "null"
+}
+
+// withinChain makes a syntax error of an alternative refer to the whole jsonpath.
+// The position is that within the whole jsonpath already, the alternative being padded.
+func withinChain(err error, path string) error {
+	if perr, ok := err.(*PathError); ok {
+		return &PathError{Err: perr.Err, Pos: perr.Pos, Path: path}
+	}
+	return err
+}
+
+// fallbackLiteral returns the json value of a literal found at pos of the jsonpath
+func fallbackLiteral(expr string, path string, pos int) ([]byte, error) {
+	lit := []byte(expr)
+	e, err := literalEnd(lit, 0)
+	if err != nil || e != len(lit) {
+		return nil, &PathError{Err: errPathFallbackValue, Pos: pos, Path: path}
+	}
+	return appendLiteral(nil, lit), nil
+}
+
+// literalEnd returns the end of the literal starting at i: a string in single or double quotes, a number, true, false or null
+func literalEnd(path []byte, i int) (int, error) {
+	switch path[i] {
+	case '\'', '"':
+		return skipString(path, i)
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return validNumber(path, i)
+	}
+	return skipBoolNull(path, i)
+}
+
+// appendLiteral appends the json value of a literal, a single-quoted string is turned into a double-quoted one
+func appendLiteral(dst []byte, lit []byte) []byte {
+	if lit[0] != '\'' {
+		return append(dst, lit...)
+	}
+	dst = append(dst, '"')
+	for i := 1; i < len(lit)-1; i++ {
+		switch {
+		case lit[i] == '\\' && lit[i+1] == '\'':
+			dst = append(dst, '\'')
+			i++
+		case lit[i] == '\\':
+			dst = append(dst, lit[i], lit[i+1])
+			i++
+		case lit[i] == '"':
+			dst = append(dst, '\\', '"')
+		default:
+			dst = append(dst, lit[i])
+		}
+	}
+	return append(dst, '"')
+}
@@ -0,0 +1,26 @@
+package jsonslice
+
+import "testing"
+
+func Test_Fallback(t *testing.T) {
+
+	doc := []byte(`{"a":{"x":1},"c":{"d":"D"},"list":[{"n":"a??b"}]}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.a.b ?? $.c.d ?? 'default'`, `"D"`},
+		{`$.a.b ?? $.c.e ?? 'default'`, `"default"`},
+		{`$.a.b??$.c.e??10`, `10`},
+		{`$.a.x ?? 2`, `1`},
+		{`$.a.b ?? null`, `null`},
+		{`$.c.d.e ?? false`, `false`},
+		{`$.a.b ?? 'it\'s "quoted"'`, `"it's \"quoted\""`},
+		{`$.a.b ?? "EUR"`, `"EUR"`},
+		{`$.list[?(@.n == 'a??b')].n ?? 1`, `["a??b"]`},
+		{`$.a.b ?? $.c.e`, `specified array element not found`},
+		{`$.a.b ?? 1x`, `path: invalid fallback value at 9`},
+		{`$.a.b ?? $.c[`, `path: index bound missing at 13`},
+		// every alternative is parsed, even those never reached
+		{`$.a.x ?? $.c[`, `path: index bound missing at 13`},
+		{`$.a.x ?? 'x' ?? 1x`, `path: invalid fallback value at 16`},
+	})
+}
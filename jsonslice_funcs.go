@@ -0,0 +1,57 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import (
+	"bytes"
+	"sync"
+)
+
+var (
+	funcs     = map[string]func(value []byte) ([]byte, error){}
+	funcsLock sync.RWMutex
+
+	builtinFuncs = []string{"length", "count", "size", "nth", "first", "last", "min", "max", "sum", "avg"}
+)
+
+// RegisterFunc adds a terminal jsonpath function: $.x.name() calls fn with the raw value of $.x
+// and the result of fn (expected to be json) is returned as is. The function takes no arguments.
+// The name is a word (letters, digits and underscores) which is neither a built-in nor already registered, it is case sensitive.
+// It is safe to register functions while queries are running.
+func RegisterFunc(name string, fn func(value []byte) ([]byte, error)) error {
+	if len(name) == 0 || fn == nil {
+		return errFuncInvalid
+	}
+	for i := 0; i < len(name); i++ {
+		if !isWordChar(name[i]) {
+			return errFuncInvalid
+		}
+	}
+	for _, builtin := range builtinFuncs {
+		if bytes.EqualFold([]byte(builtin), []byte(name)) {
+			return errFuncRegistered
+		}
+	}
+	funcsLock.Lock()
+	defer funcsLock.Unlock()
+	if _, ok := funcs[name]; ok {
+		return errFuncRegistered
+	}
+	funcs[name] = fn
+	return nil
+}
+
+// registeredFunc returns the function registered under the name
+func registeredFunc(name []byte) (func(value []byte) ([]byte, error), bool) {
+	funcsLock.RLock()
+	fn, ok := funcs[string(name)]
+	funcsLock.RUnlock()
+	return fn, ok
+}
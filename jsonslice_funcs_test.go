@@ -0,0 +1,64 @@
+package jsonslice
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func Test_RegisterFunc(t *testing.T) {
+
+	upper := func(value []byte) ([]byte, error) {
+		if value[0] != '"' {
+			return nil, errors.New("upper() is only applicable to string")
+		}
+		return bytes.ToUpper(value), nil
+	}
+	// registered once per process
+	if err := RegisterFunc("upper", upper); err != nil && err != errFuncRegistered {
+		t.Fatal(err)
+	}
+
+	doc := []byte(`{"a":"hello","b":["x","y"],"n":1,"o":{"s":"w"}}`)
+
+	tests := []struct {
+		Query    string
+		Expected string
+	}{
+		{`$.a.upper()`, `"HELLO"`},
+		{`$.o.s.upper()`, `"W"`},
+		{`$.b[0].upper()`, `"X"`},
+		{`$.n.upper()`, `upper() is only applicable to string`},
+		{`$.a.upper(1)`, `path: invalid function argument at 10`},
+		{`$.a.Upper()`, `path: unknown function at 9`},
+		{`$.a.lower()`, `path: unknown function at 9`},
+		// built-ins are still there
+		{`$.a.length()`, `7`},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(doc, tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+
+	invalid := map[string]error{
+		"":       errFuncInvalid,
+		"to-int": errFuncInvalid,
+		"upper":  errFuncRegistered,
+		"Length": errFuncRegistered,
+		"nth":    errFuncRegistered,
+	}
+	for name, expected := range invalid {
+		if err := RegisterFunc(name, upper); err != expected {
+			t.Errorf(name+" : expected %v, got %v", expected, err)
+		}
+	}
+	if err := RegisterFunc("nofunc", nil); err != errFuncInvalid {
+		t.Errorf("nil handler : expected %v, got %v", errFuncInvalid, err)
+	}
+}
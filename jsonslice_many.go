@@ -0,0 +1,83 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import (
+	"bytes"
+	"strings"
+)
+
+// GetMany returns the values matching each of the paths: values[i] and errs[i] are what Get(input, paths[i]) returns.
+// The paths starting with a top-level key ($.a.b, $['c'][0]) share a single scan of the top-level object
+// instead of seeking their keys one by one, every path is parsed once.
+func GetMany(input []byte, paths []string) ([][]byte, []error) {
+	values := make([][]byte, len(paths))
+	errs := make([]error, len(paths))
+	nodes := make([]*tNode, len(paths))
+	defer repoolAll(nodes)
+
+	shared := 0
+	for i, path := range paths {
+		if trimmed := strings.Trim(path, pathSpace); len(trimmed) <= 1 || strings.Contains(path, "??") {
+			values[i], errs[i] = Get(input, path) // the root alone, empty or a fallback chain
+			continue
+		}
+		if nodes[i], errs[i] = compilePath(path, nil); errs[i] != nil {
+			continue
+		}
+		if sharedKey(nodes[i]) != nil {
+			shared++
+		}
+	}
+
+	var keys, vals [][]byte
+	if shared > 1 {
+		if top, err := rootValue(input); err == nil && top[0] == '{' {
+			keys, vals, err = objectMembers(top)
+			if err != nil {
+				keys, vals = nil, nil // the paths report the error on their own
+			}
+		}
+	}
+	for i, node := range nodes {
+		if node == nil {
+			continue
+		}
+		if key := sharedKey(node); key != nil && keys != nil {
+			q := newQuery(input)
+			values[i], errs[i] = memberValue(q, input, keys, vals, key)
+			continue
+		}
+		values[i], errs[i] = evaluate(input, node, nil)
+	}
+	return values, errs
+}
+
+// sharedKey returns the node of the top-level key the node chain starts with, nil if the chain starts otherwise
+func sharedKey(node *tNode) *tNode {
+	key := node.Next
+	if node.Type&(cArrayType|cDeep|cSubject) > 0 || key == nil || len(key.Keys) > 0 || len(key.Key) == 0 ||
+		key.Type&cGlob > 0 || isWildcard(key) || key.Key[0] == '$' || key.Key[0] == '@' {
+		return nil
+	}
+	return key
+}
+
+// memberValue applies the key node to the members of an object, the first matching key is taken as seekKey does.
+// The value is evaluated within the input, a number needs the input following it to be told complete.
+func memberValue(q *tQuery, input []byte, keys, vals [][]byte, key *tNode) ([]byte, error) {
+	for i := range keys {
+		if bytes.EqualFold(key.Key, keys[i]) {
+			off, _ := offsetOf(input, vals[i])
+			return nodeValue(q, input[off:], key)
+		}
+	}
+	return nil, ErrArrayElementNotFound
+}
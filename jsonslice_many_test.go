@@ -0,0 +1,37 @@
+package jsonslice
+
+import "testing"
+
+func Test_GetMany(t *testing.T) {
+
+	doc := []byte(`{"a":{"b":[1,2,{"c":3}]},"s":"str","n":12,"f":-1.5e3,"A2":true,"list":[{"id":1,"n":"x"},{"id":2,"n":"y"}],"d":{"d":{"d":4}},"a":"dup"}`)
+
+	paths := []string{
+		`$.a.b`, `$.s`, `$['s']`, `$.n`, `$.f`, `$.n.x`, `$.a2`, `$.list[*].id`, `$.list[?(@.id > $.list[0].id)].n`, `$.a.b[-1].c`,
+		`$.list.length()`, `$.d..d`, `$..id`, `$`, `$.*.d`, `$.missing`, `$.s.x`, `$.a[`, ``, `$.x ?? $.s`, `$[0]`,
+	}
+
+	values, errs := GetMany(doc, paths)
+	if len(values) != len(paths) || len(errs) != len(paths) {
+		t.Fatalf("GetMany : %d values and %d errors for %d paths", len(values), len(errs), len(paths))
+	}
+	for i, path := range paths {
+		expected, expErr := Get(doc, path)
+		if string(values[i]) != string(expected) || (errs[i] == nil) != (expErr == nil) ||
+			(errs[i] != nil && errs[i].Error() != expErr.Error()) {
+			t.Errorf(path+"\n\texpected `"+string(expected)+"` (%v)\n\tbut got  `"+string(values[i])+"` (%v)", expErr, errs[i])
+		}
+	}
+
+	// not an object at the top level
+	values, errs = GetMany([]byte(`[{"a":1}]`), []string{`$.a`, `$.b`, `$[0].a`})
+	if errs[0] == nil || errs[1] == nil || string(values[2]) != `1` {
+		t.Errorf("GetMany : unexpected %q %v", values, errs)
+	}
+
+	// numbers at the top level
+	res, err := GetManyMap([]byte(`{"x":1,"y":2.5}`), map[string]string{"a": `$.x`, "b": `$.y`})
+	if err != nil || string(res) != `{"a":1,"b":2.5}` {
+		t.Errorf("GetManyMap : unexpected `%s` %v", res, err)
+	}
+}
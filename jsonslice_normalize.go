@@ -0,0 +1,196 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// normalizeStrings re-escapes every string of the value in the canonical form
+func normalizeStrings(value []byte) ([]byte, error) {
+	var res []byte
+	prev := 0
+	for i := 0; i < len(value); {
+		if value[i] != '"' {
+			i++
+			continue
+		}
+		e, err := skipString(value, i)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			res = make([]byte, 0, len(value))
+		}
+		res = append(res, value[prev:i]...)
+		res = appendCanonical(append(res, '"'), value[i+1:e-1])
+		res = append(res, '"')
+		prev, i = e, e
+	}
+	if res == nil {
+		return value, nil // no strings
+	}
+	return append(res, value[prev:]...), nil
+}
+
+// appendCanonical decodes the escape sequences of a raw string and appends it escaped in the canonical form.
+// Malformed escapes are kept as is, lone surrogates are kept escaped.
+func appendCanonical(dst []byte, raw []byte) []byte {
+	var buf [utf8.UTFMax]byte
+	for i := 0; i < len(raw); {
+		ch := raw[i]
+		if ch != '\\' || i+1 == len(raw) {
+			dst = appendChar(dst, ch)
+			i++
+			continue
+		}
+		switch raw[i+1] {
+		case '"', '\\', '/':
+			dst = appendChar(dst, raw[i+1])
+		case 'b':
+			dst = appendChar(dst, '\b')
+		case 'f':
+			dst = appendChar(dst, '\f')
+		case 'n':
+			dst = appendChar(dst, '\n')
+		case 'r':
+			dst = appendChar(dst, '\r')
+		case 't':
+			dst = appendChar(dst, '\t')
+		case 'u':
+			r, ok := readHex4(raw, i+2)
+			if !ok {
+				dst = append(dst, raw[i:i+2]...)
+				break
+			}
+			i += 4
+			if utf16.IsSurrogate(r) {
+				r2, ok := readHex4(raw, i+4)
+				if r < 0xDC00 && ok && i+3 < len(raw) && raw[i+2] == '\\' && raw[i+3] == 'u' {
+					if pair := utf16.DecodeRune(r, r2); pair != utf8.RuneError {
+						dst = append(dst, buf[:utf8.EncodeRune(buf[:], pair)]...)
+						i += 6
+						break
+					}
+				}
+				dst = appendHex4(append(dst, '\\', 'u'), r)
+				break
+			}
+			if r < utf8.RuneSelf {
+				dst = appendChar(dst, byte(r))
+			} else {
+				dst = append(dst, buf[:utf8.EncodeRune(buf[:], r)]...)
+			}
+		default:
+			dst = append(dst, raw[i:i+2]...)
+		}
+		i += 2
+	}
+	return dst
+}
+
+// readHex4 reads 4 hex digits at i
+func readHex4(raw []byte, i int) (rune, bool) {
+	if i+4 > len(raw) {
+		return 0, false
+	}
+	var r rune
+	for _, ch := range raw[i : i+4] {
+		switch {
+		case ch >= '0' && ch <= '9':
+			r = r<<4 | rune(ch-'0')
+		case ch >= 'a' && ch <= 'f':
+			r = r<<4 | rune(ch-'a'+10)
+		case ch >= 'A' && ch <= 'F':
+			r = r<<4 | rune(ch-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+	return r, true
+}
+
+func appendHex4(dst []byte, r rune) []byte {
+	const hex = "0123456789abcdef"
+	return append(dst, hex[r>>12&0xF], hex[r>>8&0xF], hex[r>>4&0xF], hex[r&0xF])
+}
+
+// normalizeNumbers rewrites every number of the value in the canonical form
+func normalizeNumbers(value []byte) ([]byte, error) {
+	var res []byte
+	prev := 0
+	for i := 0; i < len(value); {
+		ch := value[i]
+		if ch == '"' {
+			e, err := skipString(value, i)
+			if err != nil {
+				return nil, err
+			}
+			i = e
+			continue
+		}
+		if !(ch >= '0' && ch <= '9') && ch != '-' && ch != '+' && ch != '.' {
+			i++
+			continue
+		}
+		e := skipNumber(value, i)
+		if res == nil {
+			res = make([]byte, 0, len(value))
+		}
+		res = appendNumber(append(res, value[prev:i]...), value[i:e])
+		prev, i = e, e
+	}
+	if res == nil {
+		return value, nil // no numbers
+	}
+	return append(res, value[prev:]...), nil
+}
+
+// appendNumber appends a number in the canonical form: without a plus sign, leading zeros and a needless fraction
+// or exponent (1.0 is 1, 1e2 is 100), in the exponent form below 1e-6 and from 1e21 on, like encoding/json does.
+// Integers are kept digit by digit so that the precision is not lost, malformed numbers are kept as is.
+func appendNumber(dst []byte, num []byte) []byte {
+	if num[0] == '+' {
+		num = num[1:]
+	}
+	if bytes.IndexAny(num, ".eE") < 0 {
+		digits := bytes.TrimPrefix(num, []byte{'-'})
+		for len(digits) > 1 && digits[0] == '0' {
+			digits = digits[1:]
+		}
+		if len(digits) == 0 {
+			return append(dst, num...)
+		}
+		if num[0] == '-' && (len(digits) > 1 || digits[0] != '0') {
+			dst = append(dst, '-')
+		}
+		return append(dst, digits...)
+	}
+	f, err := strconv.ParseFloat(string(num), 64)
+	if err != nil {
+		return append(dst, num...)
+	}
+	if f == 0 {
+		return append(dst, '0') // -0.0 included
+	}
+	if abs := math.Abs(f); abs >= 1e-6 && abs < 1e21 {
+		return strconv.AppendFloat(dst, f, 'f', -1, 64)
+	}
+	dst = strconv.AppendFloat(dst, f, 'e', -1, 64)
+	// e-07 => e-7
+	if n := len(dst); dst[n-4] == 'e' && dst[n-2] == '0' {
+		dst = append(dst[:n-2], dst[n-1])
+	}
+	return dst
+}
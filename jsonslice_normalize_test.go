@@ -0,0 +1,66 @@
+package jsonslice
+
+import "testing"
+
+func Test_NormalizeStrings(t *testing.T) {
+
+	opts := &Options{NormalizeStrings: true}
+
+	tests := []struct {
+		Input    string
+		Query    string
+		Expected string
+	}{
+		{`{"a":"café"}`, `$.a`, `"café"`},
+		{`{"a":"\/path\/x"}`, `$.a`, `"/path/x"`},
+		{`{"a":"tab\u0009x\u000a"}`, `$.a`, `"tab\tx\n"`},
+		{`{"a":"\u0008\u000C\u001F"}`, `$.a`, `"\b\f\u001f"`},
+		{`{"a":"A\u0022\\"}`, `$.a`, `"A\"\\"`},
+		{`{"a":"😀"}`, `$.a`, `"😀"`},
+		{`{"a":"\uD83D"}`, `$.a`, `"\ud83d"`},
+		{`{"a":"\uZZZZ"}`, `$.a`, `"\uZZZZ"`},
+		{`{"a":{"key":["x",1,true]}}`, `$.a`, `{"key":["x",1,true]}`},
+		{`[{"n":"a"},{"n":"b"}]`, `$[:].n`, `["a","b"]`},
+		{`{"a":12}`, `$.a`, `12`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions([]byte(tst.Input), tst.Query, opts)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Input + " " + tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_NormalizeNumbers(t *testing.T) {
+
+	// equivalent documents, numbers formatted differently
+	inputs := []string{
+		`{"a":1,"b":[100,0.5,-2],"c":{"d":"1.0","e":-0.000001},"f":1e-7,"g":12345678901234567890,"h":2e21,"i":0}`,
+		`{"a":1.0,"b":[1e2,5E-1,-2.00],"c":{"d":"1.0","e":-1e-6},"f":0.0000001,"g":12345678901234567890,"h":2000e18,"i":-0.0}`,
+		`{"a":+1,"b":[ 1.00e+2 , 0.50 , -002 ],"c":{"d":"1.0","e":-10e-7},"f":100e-9,"g":012345678901234567890,"h":2E+21,"i":-0}`,
+	}
+	tests := []queryTest{
+		{`$`, `{"a":1,"b":[100,0.5,-2],"c":{"d":"1.0","e":-0.000001},"f":1e-7,"g":12345678901234567890,"h":2e+21,"i":0}`},
+		{`$.a`, `1`},
+		{`$.b`, `[100,0.5,-2]`},
+		{`$.b[0]`, `100`},
+		{`$..e`, `[-0.000001]`},
+		// strings are kept as is
+		{`$.c.d`, `"1.0"`},
+	}
+
+	opts := &Options{NormalizeNumbers: true}
+	for _, tst := range tests {
+		for n, input := range inputs {
+			res, err := GetWithOptions([]byte(input), tst.Query, opts)
+			// the whitespace is kept as is
+			if err != nil || string(compactValue(res)) != tst.Expected {
+				t.Errorf("%s : input %d\n\texpected `%s`\n\tbut got  `%s` (%v)", tst.Query, n, tst.Expected, res, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import "strings"
+
+// PreparedPath is a jsonpath parsed once by Compile to be applied to any number of inputs.
+// It is safe for concurrent use by multiple goroutines.
+type PreparedPath struct {
+	nodes   []*tNode // the alternatives of a ?? chain or the jsonpath alone, shared by every Get: evaluation never modifies them
+	literal []byte   // the literal ending a ?? chain, if any
+	root    bool     // the jsonpath is the root token alone
+}
+
+// Compile parses jsonpath for repeated use. The whole jsonpath is validated at once, a ?? fallback chain included,
+// so a syntax error is reported by Compile and never by the Get of the prepared path.
+func Compile(path string) (*PreparedPath, error) {
+	if len(path) == 0 {
+		return nil, errPathEmpty
+	}
+	if strings.Contains(path, "??") {
+		if alts := fallbacks(path); len(alts) > 1 {
+			nodes, literal, err := compileFallbacks(path, alts, nil)
+			if err != nil {
+				repoolAll(nodes)
+				return nil, err
+			}
+			return &PreparedPath{nodes: nodes, literal: literal}, nil
+		}
+	}
+	if trimmed := strings.Trim(path, pathSpace); len(trimmed) == 1 && trimmed[0] == '$' {
+		return &PreparedPath{root: true}, nil
+	}
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &PreparedPath{nodes: []*tNode{node}}, nil
+}
+
+// Get returns a part of input matching the prepared jsonpath, the same as Get(input, path)
+func (p *PreparedPath) Get(input []byte) ([]byte, error) {
+	if p.root {
+		return input, nil
+	}
+	if len(p.nodes) == 1 && p.literal == nil {
+		return evaluate(input, p.nodes[0], nil)
+	}
+	return fallbackValue(p.nodes, p.literal, func(node *tNode) ([]byte, error) {
+		return evaluate(input, node, nil)
+	})
+}
@@ -0,0 +1,84 @@
+package jsonslice
+
+import (
+	"sync"
+	"testing"
+)
+
+func Test_PreparedPath(t *testing.T) {
+
+	queries := []string{
+		`$`,
+		` $.store.book[0].title `,
+		`$.store.book[?(@.price > $.expensive)].title`,
+		`$.store.book[?(@.price < $.store.book[2].price)].title`,
+		`$.store.book[?(@index >= @length - 2)].author`,
+		`$.store.book[?(@.isbn && @.price > 10)].isbn`,
+		`$.store.book[?(@.title =~ /the/i)].title`,
+		`$..book[-1]['author','price']`,
+		`$.store.*[:].price`,
+		`$.store.book.length()`,
+		`$.store.b*.color`,
+		`$.missing`,
+		`$.zz ?? 'x'`,
+		`$.missing ?? $.store.bicycle.color ?? 0`,
+		`$.store.book[?(@.isbn)].isbn ?? $.store.book[0].title`,
+	}
+
+	docs := [][]byte{data, []byte(`{"expensive":20,"store":{"book":[{"title":"The A","price":5},{"title":"B","price":25,"isbn":"1"}]}}`)}
+
+	prepared := make([]*PreparedPath, len(queries))
+	expected := make([][]string, len(queries))
+	for i, query := range queries {
+		path, err := Compile(query)
+		if err != nil {
+			t.Fatalf(query+" : unexpected error %v", err)
+		}
+		prepared[i] = path
+		for _, doc := range docs {
+			res, err := Get(doc, query)
+			if err != nil {
+				res = []byte(err.Error())
+			}
+			expected[i] = append(expected[i], string(res))
+		}
+	}
+
+	// the same prepared paths are used by several goroutines at once against different inputs
+	var wg sync.WaitGroup
+	errs := make(chan string, 64)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				for i, path := range prepared {
+					d := (g + n + i) % len(docs)
+					res, err := path.Get(docs[d])
+					if err != nil {
+						res = []byte(err.Error())
+					}
+					if string(res) != expected[i][d] {
+						select {
+						case errs <- queries[i] + "\n\texpected `" + expected[i][d] + "`\n\tbut got  `" + string(res) + "`":
+						default:
+						}
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf(err)
+	}
+
+	// syntax errors are reported by Compile
+	for _, query := range []string{``, `store`, `$.a[`, `$.a[?(@.b == )]`, `$.a.unknown()`, `$.a ?? $.b[`, `$.a ?? 'x' ?? $.b[`} {
+		if _, err := Compile(query); err == nil {
+			t.Errorf(query + " : error expected")
+		}
+	}
+}
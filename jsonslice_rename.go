@@ -0,0 +1,99 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+// Rename returns a copy of input with the key of the object member at jsonpath replaced by newKey.
+// The last step of jsonpath must be a key ($.a.b, $.a[0]['b']), every member it matches is renamed.
+// The values and the member order are kept intact, newKey is escaped as needed.
+func Rename(input []byte, path, newKey string) ([]byte, error) {
+
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer repool(node)
+
+	last := node
+	for last.Next != nil {
+		last = last.Next
+	}
+	if last == node || len(last.Key) == 0 || len(last.Keys) > 0 ||
+		last.Type&(cArrayType|cFunction|cGlob) > 0 || isWildcard(last) {
+		return nil, errPathMemberExpected
+	}
+
+	q := newQuery(input)
+	elems, err := getElements(q, input, node, nil)
+	if isNotFound(err) || (err == nil && len(elems) == 0) {
+		return nil, ErrFieldNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the keys are replaced in the order they appear in input, each one once ($..b, $.a[1,0].b, $.a[0,0].b)
+	spans := make([][2]int, 0, len(elems))
+	for _, elem := range elems {
+		off, ok := offsetOf(input, elem)
+		if !ok {
+			return nil, errComputedValue
+		}
+		start, end, err := keyBefore(input, off)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, [2]int{start, end})
+	}
+	if spans, err = editSpans(spans); err != nil {
+		return nil, err
+	}
+
+	key := appendString(nil, newKey)
+	result := make([]byte, 0, len(input)+len(spans)*len(key))
+	prev := 0
+	for _, span := range spans {
+		result = append(append(result, input[prev:span[0]]...), key...)
+		prev = span[1]
+	}
+	return append(result, input[prev:]...), nil
+}
+
+// keyBefore returns the [start,end) offsets of the quoted key of the object member whose value begins at off
+func keyBefore(input []byte, off int) (int, int, error) {
+	i := off - 1
+	for i >= 0 && bytein(input[i], []byte{' ', '\t', '\r', '\n'}) {
+		i--
+	}
+	if i < 0 || input[i] != ':' {
+		return 0, 0, errColonExpected
+	}
+	i--
+	for i >= 0 && bytein(input[i], []byte{' ', '\t', '\r', '\n'}) {
+		i--
+	}
+	if i < 0 || input[i] != '"' {
+		return 0, 0, errKeyExpected
+	}
+	end := i + 1
+	// the opening quote is the first one not preceded by an odd number of backslashes
+	for i--; i >= 0; i-- {
+		if input[i] != '"' {
+			continue
+		}
+		n := 0
+		for j := i - 1; j >= 0 && input[j] == '\\'; j-- {
+			n++
+		}
+		if n%2 == 0 {
+			return i, end, nil
+		}
+	}
+	return 0, 0, errKeyExpected
+}
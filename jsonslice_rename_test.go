@@ -0,0 +1,60 @@
+package jsonslice
+
+import "testing"
+
+func Test_Rename(t *testing.T) {
+
+	doc := []byte(`{"a":{"b" : 1, "c":[{"b":2},{"d":3}]}, "say \"hi\"":true}`)
+
+	tests := []struct {
+		Query    string
+		NewKey   string
+		Expected string
+	}{
+		{`$.a.b`, `x`, `{"a":{"x" : 1, "c":[{"b":2},{"d":3}]}, "say \"hi\"":true}`},
+		{`$.a.c[:].b`, `x`, `{"a":{"b" : 1, "c":[{"x":2},{"d":3}]}, "say \"hi\"":true}`},
+		{`$..b`, `y`, `{"a":{"y" : 1, "c":[{"y":2},{"d":3}]}, "say \"hi\"":true}`},
+		{`$.a`, `my "key"\`, `{"my \"key\"\\":{"b" : 1, "c":[{"b":2},{"d":3}]}, "say \"hi\"":true}`},
+		{`$['say \"hi\"']`, `said`, `{"a":{"b" : 1, "c":[{"b":2},{"d":3}]}, "said":true}`},
+		// errors
+		{`$.a.missing`, `x`, `field not found`},
+		{`$.a.c[:].missing`, `x`, `field not found`},
+		{`$.a.c[0]`, `x`, `path: object member expected`},
+		{`$.a.*`, `x`, `path: object member expected`},
+		{`$`, `x`, `path: object member expected`},
+	}
+
+	for _, tst := range tests {
+		res, err := Rename(doc, tst.Query, tst.NewKey)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+
+	// the matches are renamed in the order of the input whatever order they are found in, each one once
+	nested := []byte(`{"x":{"name":1},"name":2}`)
+	list := []byte(`{"a":[{"x":1},{"x":2}]}`)
+	ordered := []struct {
+		Data     []byte
+		Query    string
+		Expected string
+	}{
+		{nested, `$..name`, `{"x":{"n":1},"n":2}`},
+		{list, `$.a[1,0].x`, `{"a":[{"n":1},{"n":2}]}`},
+		{list, `$.a[0,0].x`, `{"a":[{"n":1},{"x":2}]}`},
+		{list, `$.a[::-1].x`, `{"a":[{"n":1},{"n":2}]}`},
+	}
+
+	for _, tst := range ordered {
+		res, err := Rename(tst.Data, tst.Query, `n`)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
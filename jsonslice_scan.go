@@ -0,0 +1,103 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+// Handler receives the events of Scan. Keys are passed without quotes, values are raw json scalars.
+// Returning an error from any method stops the scan with that error.
+type Handler interface {
+	OnObjectStart() error
+	OnKey(key []byte) error
+	OnValue(value []byte) error
+	OnArrayStart() error
+	OnArrayEnd() error
+	OnObjectEnd() error
+}
+
+// Scan pushes the structure of input to handler in document order, without building any values.
+// The input is read in a single pass, so the events preceding a malformed part are emitted before the error is returned.
+func Scan(input []byte, handler Handler) error {
+	i, err := skipSpaces(input, 0)
+	if err != nil {
+		return err
+	}
+	if i, err = scanValue(input, i, handler); err != nil {
+		return err
+	}
+	if validSpaces(input, i) < len(input) {
+		return errTrailingData
+	}
+	return nil
+}
+
+// scanValue emits the events of the value starting at i and returns the position right after it
+func scanValue(input []byte, i int, handler Handler) (int, error) {
+	switch input[i] {
+	case '{':
+		return scanObject(input, i, handler)
+	case '[':
+		return scanArray(input, i, handler)
+	}
+	e, err := validValue(input, i)
+	if err != nil {
+		return e, err
+	}
+	return e, handler.OnValue(input[i:e])
+}
+
+func scanObject(input []byte, i int, handler Handler) (int, error) {
+	if err := handler.OnObjectStart(); err != nil {
+		return i, err
+	}
+	i, err := skipSpaces(input, i+1)
+	if err != nil {
+		return i, err
+	}
+	for input[i] != '}' {
+		if input[i] != '"' {
+			return i, errKeyExpected
+		}
+		e, err := skipString(input, i)
+		if err != nil {
+			return i, err
+		}
+		if err = handler.OnKey(input[i+1 : e-1]); err != nil {
+			return i, err
+		}
+		if i, err = seekToValue(input, e); err != nil {
+			return i, err
+		}
+		if i, err = scanValue(input, i, handler); err != nil {
+			return i, err
+		}
+		if i, err = skipSpaces(input, i); err != nil {
+			return i, err
+		}
+	}
+	return i + 1, handler.OnObjectEnd()
+}
+
+func scanArray(input []byte, i int, handler Handler) (int, error) {
+	if err := handler.OnArrayStart(); err != nil {
+		return i, err
+	}
+	i, err := skipSpaces(input, i+1)
+	if err != nil {
+		return i, err
+	}
+	for input[i] != ']' {
+		if i, err = scanValue(input, i, handler); err != nil {
+			return i, err
+		}
+		if i, err = skipSpaces(input, i); err != nil {
+			return i, err
+		}
+	}
+	return i + 1, handler.OnArrayEnd()
+}
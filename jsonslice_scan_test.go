@@ -0,0 +1,67 @@
+package jsonslice
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testHandler struct {
+	events []string
+	stopAt string
+}
+
+func (h *testHandler) event(e string) error {
+	h.events = append(h.events, e)
+	if e == h.stopAt {
+		return errors.New("stopped")
+	}
+	return nil
+}
+
+func (h *testHandler) OnObjectStart() error       { return h.event("{") }
+func (h *testHandler) OnKey(key []byte) error     { return h.event("key " + string(key)) }
+func (h *testHandler) OnValue(value []byte) error { return h.event(string(value)) }
+func (h *testHandler) OnArrayStart() error        { return h.event("[") }
+func (h *testHandler) OnArrayEnd() error          { return h.event("]") }
+func (h *testHandler) OnObjectEnd() error         { return h.event("}") }
+
+func Test_Scan(t *testing.T) {
+
+	doc := []byte(` {"a": [1, {"b": "x y"}, []], "c": {}, "d": null} `)
+
+	tests := []struct {
+		Input    []byte
+		StopAt   string
+		Expected string
+	}{
+		{doc, ``, `{|key a|[|1|{|key b|"x y"|}|[|]|]|key c|{|}|key d|null|}`},
+		{doc, `key b`, `{|key a|[|1|{|key b|stopped`},
+		{[]byte(`"str"`), ``, `"str"`},
+		{[]byte(`{"a" 1}`), ``, `{|key a|':' expected`},
+		// the input is read once, the events before a malformed part are emitted
+		{[]byte(`{"a": [1, 2}`), ``, `{|key a|[|1|2|unrecognized value: true, false or null expected`},
+		{[]byte(`{"a": [1, "x`), ``, `{|key a|[|1|unexpected end of input`},
+		// a top-level scalar is validated as well
+		{[]byte(` 12 `), ``, `12`},
+		{[]byte(`tru`), ``, `unrecognized value: true, false or null expected`},
+		{[]byte(`12x`), ``, `12|unexpected data after the value`},
+		{[]byte(`01`), ``, `0|unexpected data after the value`},
+		{[]byte(`{} x`), ``, `{|}|unexpected data after the value`},
+		{[]byte(`  `), ``, `unexpected end of input`},
+	}
+
+	for _, tst := range tests {
+		h := &testHandler{stopAt: tst.StopAt}
+		err := Scan(tst.Input, h)
+		res := strings.Join(h.events, "|")
+		if err != nil && res != "" {
+			res += "|" + err.Error()
+		} else if err != nil {
+			res = err.Error()
+		}
+		if res != tst.Expected {
+			t.Errorf(string(tst.Input) + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + res + "`")
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+// GetSpans returns [start,end) offsets of every element matching jsonpath.
+// The offsets point into input, so nothing is copied: input[span[0]:span[1]] is a matched value.
+// Functions are not supported since their results do not exist in the input.
+func GetSpans(input []byte, path string) ([][2]int, error) {
+
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := newQuery(input)
+
+	elems, err := getElements(q, input, node, nil)
+	repool(node)
+	if err != nil {
+		return nil, err
+	}
+
+	spans := make([][2]int, 0, len(elems))
+	for _, elem := range elems {
+		start, ok := offsetOf(input, elem)
+		if !ok {
+			return nil, errComputedValue
+		}
+		spans = append(spans, [2]int{start, start + len(elem)})
+	}
+	return spans, nil
+}
+
+// GetOffsets is an alias of GetSpans: offsets[i][0]:offsets[i][1] is the position of the i-th matched element in input,
+// one per element even if the jsonpath aggregates, so the matches may be sought in the original input (e.g. a mapped file).
+func GetOffsets(input []byte, path string) ([][2]int, error) {
+	return GetSpans(input, path)
+}
+
+// GetSize returns the size in bytes of the value matching jsonpath, the same as len(Get(input, path)).
+// The value is not copied unless the matched elements are merged into an array or computed by a function.
+func GetSize(input []byte, path string) (int, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return 0, err
+	}
+	return len(value), nil
+}
+
+// GetNthMatch returns the n-th (0-based) of the elements matching jsonpath, like the third price found by $..price for n=2.
+// The query stops as soon as the element is found.
+func GetNthMatch(input []byte, path string, n int) ([]byte, error) {
+
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer repool(node)
+	if n < 0 {
+		return nil, ErrArrayElementNotFound
+	}
+
+	q := newQuery(input)
+	q.limit = n + 1
+
+	elems, err := getElements(q, input, node, nil)
+	if err != nil {
+		return nil, err
+	}
+	if n >= len(elems) {
+		return nil, ErrArrayElementNotFound
+	}
+	return elems[n], nil
+}
+
+// offsetOf returns the position of sub within input, provided sub is a subslice of input
+func offsetOf(input []byte, sub []byte) (int, bool) {
+	if len(sub) == 0 {
+		return 0, false
+	}
+	off := cap(input) - cap(sub)
+	if off < 0 || off >= len(input) || &input[off] != &sub[0] {
+		return 0, false
+	}
+	return off, true
+}
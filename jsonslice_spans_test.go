@@ -0,0 +1,165 @@
+package jsonslice
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_Spans(t *testing.T) {
+
+	tests := []struct {
+		Query    string
+		Expected []string
+	}{
+		{`$.expensive`, []string{`10`}},
+		{`$.store.book[1].author`, []string{`"Evelyn Waugh"`}},
+		{`$.store.book[-1].price`, []string{`22.99`}},
+		{`$.store.book[1:3].author`, []string{`"Evelyn Waugh"`, `"Herman Melville"`}},
+		{`$.store.book[0,2].title`, []string{`"Sayings of the Century"`, `"Moby Dick"`}},
+		{`$.store.book[?(@.price > 10)].title`, []string{`"Sword of Honour"`, `"The Lord of the Rings"`}},
+		{`$.store.book[:].isbn`, []string{`"0-553-21311-3"`, `"0-395-19395-8"`}},
+		{`$.store.book[0].*`, []string{`"reference"`, `"Nigel Rees"`, `"Sayings of the Century"`, `8.95`}},
+		{`$.store.*[:].price`, []string{`8.95`, `12.99`, `8.99`, `22.99`}},
+		{`$.store.bicycle['color','price']`, []string{`"red"`, `19.95`}},
+		{`$.store.bicycle.equipment[1:3]`, []string{`["peg leg", "parrot", "map"]`, `["light saber", "apparel"]`}},
+	}
+
+	for _, tst := range tests {
+		spans, err := GetSpans(condensed, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+			continue
+		}
+		if len(spans) != len(tst.Expected) {
+			t.Errorf(tst.Query+" : result length mismatch (%d expected, %d received)", len(tst.Expected), len(spans))
+			continue
+		}
+		for i, span := range spans {
+			if got := string(condensed[span[0]:span[1]]); got != tst.Expected[i] {
+				t.Errorf(tst.Query + "\n\texpected `" + tst.Expected[i] + "`\n\tbut got  `" + got + "`")
+			}
+		}
+	}
+
+	if _, err := GetSpans(condensed, `$.store.book.length()`); err != errComputedValue {
+		t.Errorf("$.store.book.length() : expected %v, got %v", errComputedValue, err)
+	}
+}
+
+func Test_GetSize(t *testing.T) {
+
+	queries := []string{
+		`$`,
+		`$.store`,
+		`$.store.book[0].title`,
+		`$.store.book[-1]`,
+		`$.store.book[1:3]`,
+		`$.store.book[:].price`,
+		`$.store.book[?(@.price > 10)].title`,
+		`$.store.book[0]['title','price']`,
+		`$..price`,
+		`$.store.*`,
+		`$.missing`,
+		`$.store.book.length()`,
+		`$..book[*].author.length()`,
+	}
+
+	// data is indented, the whitespace within a slice is counted as Get returns it
+	for _, query := range queries {
+		res, err := Get(data, query)
+		size, err2 := GetSize(data, query)
+		if (err == nil) != (err2 == nil) {
+			t.Errorf(query+" : errors differ: %v, %v", err, err2)
+		} else if err == nil && size != len(res) {
+			t.Errorf(query+" : size %d, len(Get) %d", size, len(res))
+		}
+	}
+}
+
+func Test_GetOffsets(t *testing.T) {
+
+	doc := []byte(`{"a": {"b": 1}, "list": [ {"id": 1}, {"id": 22} , {"x": 0} ]}`)
+
+	tests := []struct {
+		Query    string
+		Expected []string
+	}{
+		{`$.a.b`, []string{`1`}},
+		{`$.a`, []string{`{"b": 1}`}},
+		{`$.list[*].id`, []string{`1`, `22`}},
+		{`$.list[-1]`, []string{`{"x": 0}`}},
+		{`$.list[:2].id`, []string{`1`, `22`}},
+		{`$..id`, []string{`1`, `22`}},
+	}
+
+	for _, tst := range tests {
+		offsets, err := GetOffsets(doc, tst.Query)
+		if err != nil || len(offsets) != len(tst.Expected) {
+			t.Errorf(tst.Query+" : unexpected %v (%v)", offsets, err)
+			continue
+		}
+		for i, span := range offsets {
+			if got := string(doc[span[0]:span[1]]); got != tst.Expected[i] {
+				t.Errorf(tst.Query+" [%d] : expected `%s` but got `%s` at %d:%d", i, tst.Expected[i], got, span[0], span[1])
+			}
+		}
+	}
+
+	if _, err := GetOffsets(doc, `$.list.length()`); err == nil {
+		t.Errorf("GetOffsets : function result expected to fail")
+	}
+}
+
+func Test_GetNthMatch(t *testing.T) {
+
+	nested := []byte(`{"price":0,"items":[{"a":{"price":1}},[{"price":2},{"b":[{"price":3}]}]],"c":{"d":[[{"price":4}]]}}`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		N        int
+		Expected string
+	}{
+		{nested, `$..price`, 0, `0`},
+		{nested, `$..price`, 2, `2`},
+		{nested, `$..price`, 4, `4`},
+		{nested, `$..price`, 5, `specified array element not found`},
+		{nested, `$..price`, -1, `specified array element not found`},
+		{nested, `$.items..price`, 1, `2`},
+		{data, `$.store.book[*].author`, 1, `"Evelyn Waugh"`},
+		{data, `$.store.book[?(@.price > 10)].title`, 1, `"The Lord of the Rings"`},
+		{data, `$.store.*.color`, 0, `"red"`},
+		{data, `$.store.book[-1]['author','price']`, 1, `22.99`},
+		{data, `$.store.book[0].title`, 0, `"Sayings of the Century"`},
+		{data, `$.store.book[0].missing`, 0, `specified array element not found`},
+		// functions are applied to the matched values
+		{data, `$.store.bicycle.equipment[*].length()`, 0, `4`},
+		{data, `$..book.length()`, 0, `4`},
+		{data, `$.store.book.length()`, 0, `4`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetNthMatch(tst.Data, tst.Query, tst.N)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+
+	// the n-th match is the n-th element of the Get result
+	for _, query := range []string{`$..price`, `$..*`, `$.store..price`, `$.store.book[*].author`, `$..book[?(@.isbn)].title`, `$..book[*].author.length()`} {
+		res, _ := Get(data, query)
+		all, err := arrayValues(res)
+		if err != nil {
+			t.Fatalf(query+" : unexpected error %v", err)
+		}
+		for n, elem := range all {
+			res, err := GetNthMatch(data, query, n)
+			if err != nil || !bytes.Equal(res, elem) {
+				t.Errorf(query+" [%d] : expected `%s`, got `%s` (%v)", n, elem, res, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import (
+	"context"
+	"io"
+)
+
+// GetMerged applies jsonpath to each of the concatenated top-level values of input
+// (for example a log file which is a sequence of json objects) and merges the results into an array.
+// Values lacking the path are skipped.
+func GetMerged(input []byte, path string) ([]byte, error) {
+
+	prepared, err := Compile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []byte{'['}
+	l := len(input)
+	i := 0
+	for {
+		if i, _ = skipSpaces(input, i); i == l {
+			break
+		}
+		e, err := skipValue(input, i)
+		if err != nil {
+			return nil, err
+		}
+		value, err := prepared.Get(input[i:e])
+		if err == nil {
+			if len(result) > 1 {
+				result = append(result, ',')
+			}
+			result = append(result, value...)
+		} else if !isNotFound(err) {
+			return nil, err
+		}
+		i = e
+	}
+	return append(result, ']'), nil
+}
+
+// GetFrom applies jsonpath to the top-level value of concatenated values which starts at offset (whitespace skipped)
+// and returns the result along with the offset just past that value, where the next value is to be looked for.
+// The next offset is returned even if the value lacks jsonpath, so that the values can be stepped through.
+// An unexpected end of input is reported once only whitespace is left.
+func GetFrom(input []byte, offset int, path string) ([]byte, int, error) {
+	if offset < 0 || offset > len(input) {
+		return nil, offset, errOffsetOutOfRange
+	}
+	i, _ := skipSpaces(input, offset)
+	if i == len(input) {
+		return nil, i, errUnexpectedEnd
+	}
+	e, err := skipValue(input, i)
+	if err != nil {
+		return nil, offset, err
+	}
+	value, err := Get(input[i:e], path)
+	return value, e, err
+}
+
+// GetAsNDJSON writes the elements matching an aggregating jsonpath, or the elements of the array matching jsonpath,
+// to w one per line (newline-delimited json) and returns the number of elements written.
+// The elements are compacted so that each one fits on a line. They are written as they are found, the merged array is never built.
+func GetAsNDJSON(w io.Writer, input []byte, path string) (int, error) {
+	var line []byte
+	var werr error
+	n := 0
+	err := streamElements(input, path, func(elem []byte) bool {
+		line = append(append(line[:0], compactValue(elem)...), '\n')
+		if _, werr = w.Write(line); werr != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// GetChan sends the elements matching an aggregating jsonpath, or the elements of the array matching jsonpath,
+// over the first channel as they are found, closing it when done. An error is sent over the second channel, which is closed afterwards,
+// so it is read once the elements are drained. The elements are subslices of input, not copies.
+// The element channel must be drained, otherwise the sending goroutine is never done: use GetChanContext to stop early.
+func GetChan(input []byte, path string) (<-chan []byte, <-chan error) {
+	return GetChanContext(context.Background(), input, path)
+}
+
+// GetChanContext is GetChan stopped by cancelling ctx: the query ends, the element channel is closed
+// and ctx.Err() is sent over the error channel.
+func GetChanContext(ctx context.Context, input []byte, path string) (<-chan []byte, <-chan error) {
+	out := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(out)
+		err := streamElements(input, path, func(elem []byte) bool {
+			if ctx.Err() != nil {
+				return false
+			}
+			select {
+			case out <- elem:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return out, errc
+}
+
+// streamElements passes emit the elements matching an aggregating jsonpath as they are found,
+// or the elements of the array matching jsonpath. The query stops once emit returns false.
+func streamElements(input []byte, path string, emit func([]byte) bool) error {
+
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return err
+	}
+	defer repool(node)
+
+	q := newQuery(input)
+
+	if aggregates(node) {
+		q.emit = emit
+		_, err = getElements(q, input, node, nil)
+		return err
+	}
+	elems, err := getElements(q, input, node, nil)
+	if err != nil {
+		return err
+	}
+	return eachElement(elems[0], emit)
+}
+
+// eachElement passes emit the elements of an array until it returns false
+func eachElement(input []byte, emit func([]byte) bool) error {
+	if input[0] != '[' {
+		return errArrayExpected
+	}
+	i, err := skipSpaces(input, 1)
+	if err != nil {
+		return err
+	}
+	for input[i] != ']' {
+		e, err := skipValue(input, i)
+		if err != nil {
+			return err
+		}
+		if !emit(input[i:e]) {
+			return nil
+		}
+		if i, err = skipSpaces(input, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// arrayValues returns the elements of an array
+func arrayValues(input []byte) ([][]byte, error) {
+	if input[0] != '[' {
+		return nil, errArrayExpected
+	}
+	spans, err := arrayScan(input)
+	if err != nil {
+		return nil, err
+	}
+	elems := make([][]byte, len(spans))
+	for i, span := range spans {
+		elems[i] = input[span.start:span.end]
+	}
+	return elems, nil
+}
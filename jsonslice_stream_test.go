@@ -0,0 +1,209 @@
+package jsonslice
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_GetMerged(t *testing.T) {
+
+	stream := []byte(`{"event":"start","n":1}
+{"event":"click","n":2}  {"n":3}
+{"event":"stop","n":4,"tags":["a","b"]}
+`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected string
+	}{
+		{stream, `$.event`, `["start","click","stop"]`},
+		{stream, `$.n`, `[1,2,3,4]`},
+		{stream, `$.tags[0]`, `["a"]`},
+		{stream, `$.missing`, `[]`},
+		{[]byte(``), `$.event`, `[]`},
+		// the path is compiled once, root references are resolved against each value
+		{[]byte(`{"min":1,"v":[1,2]} {"min":2,"v":[1,2,3]}`), `$.v[?(@ > $.min)]`, `[[2],[3]]`},
+		{[]byte(`{"a":1} [2]`), `$`, `[{"a":1},[2]]`},
+		// a fallback is applied to each value
+		{[]byte(`{"a":1}{"b":2}`), `$.a ?? 0`, `[1,0]`},
+		{[]byte(`{"a":1}{"b":2}{"c":3}`), `$.a ?? $.b`, `[1,2]`},
+		{stream, `$.event ?? $.b[`, `path: index bound missing at 15`},
+		// truncated value
+		{[]byte(`{"event":"a"} {"event":`), `$.event`, `unexpected end of input`},
+		// invalid path
+		{stream, `$.event(`, `path: invalid element reference at 7`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetMerged(tst.Data, tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_GetFrom(t *testing.T) {
+
+	input := []byte(`{"id":1,"v":"a"} {"id":2}
+	{"id":3,"v":"c"}  `)
+
+	// the second value lacks the path
+	expected := []string{`"a"`, ``, `"c"`}
+
+	off := 0
+	for n := 0; ; n++ {
+		value, next, err := GetFrom(input, off, `$.v`)
+		if err == errUnexpectedEnd {
+			if n != len(expected) || next != len(input) {
+				t.Errorf("end of input after %d values at %d", n, next)
+			}
+			break
+		}
+		if n == len(expected) {
+			t.Fatalf("unexpected value %d at %d: %s (%v)", n, off, value, err)
+		}
+		if string(value) != expected[n] || (err != nil) != (expected[n] == ``) || (err != nil && !isNotFound(err)) {
+			t.Errorf("value %d: expected %s, got %s (%v)", n, expected[n], value, err)
+		}
+		if next <= off || input[next-1] != '}' {
+			t.Fatalf("value %d: unexpected next offset %d", n, next)
+		}
+		off = next
+	}
+
+	if _, _, err := GetFrom(input, len(input)+1, `$.v`); err != errOffsetOutOfRange {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, next, err := GetFrom([]byte(`{"a":1} {"a":`), 7, `$.a`); err == nil || next != 7 {
+		t.Errorf("truncated value: unexpected next offset %d (%v)", next, err)
+	}
+}
+
+func Test_GetAsNDJSON(t *testing.T) {
+
+	doc := []byte(`{"a": [ {"x": 1, "y": "a b"}, 2, [3, 4] ], "b": {"c": [5]}, "s": "str"}`)
+
+	tests := []struct {
+		Query    string
+		Expected string
+		Count    int
+	}{
+		{`$.a`, "{\"x\":1,\"y\":\"a b\"}\n2\n[3,4]\n", 3},
+		{`$.a[1:]`, "2\n[3,4]\n", 2},
+		{`$.a[?(@.x)].y`, "\"a b\"\n", 1},
+		{`$..c`, "[5]\n", 1},
+		{`$.b.c`, "5\n", 1},
+		{`$.a[?(@.x > 5)]`, "", 0},
+		{`$.b`, "array expected", 0},
+		{`$.s`, "array expected", 0},
+		{`$.a.length()`, "array expected", 0},
+		{`$..c.length()`, "1\n", 1},
+	}
+
+	for _, tst := range tests {
+		var buf strings.Builder
+		n, err := GetAsNDJSON(&buf, doc, tst.Query)
+		res := buf.String()
+		if err != nil {
+			res = err.Error()
+		}
+		if res != tst.Expected || n != tst.Count {
+			t.Errorf(tst.Query+"\n\texpected `"+tst.Expected+"` (%d)\n\tbut got  `"+res+"` (%d)", tst.Count, n)
+		}
+	}
+}
+
+func Test_GetChan(t *testing.T) {
+
+	doc := []byte(`{"a": [ {"x": 1, "y": "a b"}, 2, [3, 4] ], "b": {"c": [5]}, "s": "str"}`)
+
+	tests := []struct {
+		Query    string
+		Expected string
+	}{
+		{`$.a`, `{"x": 1, "y": "a b"}|2|[3, 4]`},
+		{`$.a[1:]`, `2|[3, 4]`},
+		{`$.a[?(@.x)].y`, `"a b"`},
+		{`$..c`, `[5]`},
+		{`$.a[?(@.x > 5)]`, ``},
+		{`$.b`, `array expected`},
+		{`$.a[`, `path: index bound missing at 4`},
+	}
+
+	for _, tst := range tests {
+		elems, errc := GetChan(doc, tst.Query)
+		var got []string
+		for elem := range elems {
+			got = append(got, string(elem))
+		}
+		res := strings.Join(got, "|")
+		if err := <-errc; err != nil {
+			res = err.Error()
+		}
+		if res != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + res + "`")
+		}
+	}
+
+	// counted by a concurrent downstream stage
+	elems, errc := GetChan([]byte(`{"n":[1,2,3,4,5,6,7,8,9,10]}`), `$.n[?(@ > 3)]`)
+	counted := make(chan int)
+	go func() {
+		n := 0
+		for range elems {
+			n++
+		}
+		counted <- n
+	}()
+	if n := <-counted; n != 7 {
+		t.Errorf("GetChan : %d elements instead of 7", n)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("GetChan : " + err.Error())
+	}
+
+	// the query stops once cancelled, the channels are closed
+	doc = []byte(`{"n":[1,2,3,4,5,6,7,8,9,10],"m":[{"k":1},{"k":2},{"k":3}]}`)
+	for _, query := range []string{`$.n[?(@ > 3)]`, `$..k`, `$.n`} {
+		ctx, cancel := context.WithCancel(context.Background())
+		elems, errc = GetChanContext(ctx, doc, query)
+		first := <-elems
+		cancel()
+		n := 0
+		for range elems {
+			n++
+		}
+		if err := <-errc; !errors.Is(err, context.Canceled) || len(first) == 0 || n > 1 {
+			t.Errorf(query+" : cancelled after `%s` and %d more elements (%v)", first, n, err)
+		}
+	}
+}
+
+type failingWriter struct {
+	lines int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.lines == 0 {
+		return 0, errors.New("write failed")
+	}
+	w.lines--
+	return len(p), nil
+}
+
+func Test_GetAsNDJSONWriteError(t *testing.T) {
+
+	// the query stops at the first failed write
+	for _, query := range []string{`$.n[*]`, `$.n`} {
+		n, err := GetAsNDJSON(&failingWriter{lines: 2}, []byte(`{"n":[1,2,3,4]}`), query)
+		if n != 2 || err == nil || err.Error() != "write failed" {
+			t.Errorf(query+" : %d elements written (%v)", n, err)
+		}
+	}
+}
@@ -3,8 +3,11 @@ package jsonslice
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"strconv"
 	"testing"
 	"time"
 
@@ -97,6 +100,26 @@ func randomBytes(p []byte, min, max int) {
 	}
 }
 
+// queryTest is a jsonpath with the value expected from it, or the text of the error expected
+type queryTest struct {
+	Query    string
+	Expected string
+}
+
+// checkQueries runs the queries against the input in turn and reports every unexpected result
+func checkQueries(t *testing.T, input []byte, opts *Options, tests []queryTest) {
+	t.Helper()
+	for _, tst := range tests {
+		res, err := GetWithOptions(input, tst.Query, opts)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf("%s\n\texpected `%s`\n\tbut got  `%s`", tst.Query, tst.Expected, res)
+		}
+	}
+}
+
 func TestFuzzyPath(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode.")
@@ -121,7 +144,7 @@ func TestFuzzyPath(t *testing.T) {
 		n := rand.Intn(len(b))
 		b[0] = '$'
 		str = string(b[:n])
-		parsePath([]byte(str))
+		parsePath([]byte(str), true)
 	}
 	fmt.Println()
 }
@@ -148,163 +171,1832 @@ func TestFuzzyGet(t *testing.T) {
 		}
 		n, err := rand.Read(b[:rand.Int()%len(b)])
 		if err != nil {
-			t.Fatal(err)
+			t.Fatal(err)
+		}
+		str = string(b[:n])
+		Get([]byte(str), "$.some.value")
+	}
+	fmt.Println()
+}
+
+func Test_10Mb(t *testing.T) {
+	largeData := GenerateLargeData()
+	expected := []byte(`"Sword of Honour"`)
+	path := "$.store.book[100000].title"
+	res, err := Get(largeData, path)
+	if compareSlices(res, expected) != 0 && err == nil {
+		t.Errorf(path + "\nexpected:\n" + string(expected) + "\ngot:\n" + string(res))
+	}
+}
+
+func Test_Expressions(t *testing.T) {
+
+	tests := []struct {
+		Query    string
+		Expected []byte
+	}{
+		// self
+		{`$`, data},
+		// simple query
+		{`$.expensive`, []byte(`10`)},
+		// simple query
+		{`$.store.book[3].author`, []byte(`"J. R. R. Tolkien"`)},
+
+		// boolean, null
+		{`$.store.open`, []byte(`true`)},
+		{`$.store.branch`, []byte(`null`)},
+
+		// negative index
+		{`$.store.book[-1].author`, []byte(`"J. R. R. Tolkien"`)},
+		// negative indexes
+		{`$.store.book[-3:-2].author`, []byte(`["Evelyn Waugh"]`)},
+
+		// functions
+		{`$.store.book.length()`, []byte(`4`)},
+		{`$.store.book.count()`, []byte(`4`)},
+		{`$.store.book.size()`, []byte(`604`)},
+
+		// aggregated
+		{`$.store.book[1:3].author`, []byte(`["Evelyn Waugh","Herman Melville"]`)},
+		// aggregated, skip missing keys
+		{`$.store.book[1:].isbn`, []byte(`["0-553-21311-3","0-395-19395-8"]`)},
+		// aggregated, enumerate indexes
+		{`$.store.book[0,2].title`, []byte(`["Sayings of the Century","Moby Dick"]`)},
+
+		// filters: simple expression
+		{`$.store.book[?(@.price>10)].title`, []byte(`["Sword of Honour","The Lord of the Rings"]`)},
+		// filters: simple expression + spaces
+		{`$.store.book[?(@.price < 10)].title`, []byte(`["Sayings of the Century","Moby Dick"]`)},
+		// filters: simple expression
+		{`$.store.book[?(@.price==12.99)].title`, []byte(`["Sword of Honour"]`)},
+		// more spaces
+		{`$.store.book[?(   @.price   >   10)].title`, []byte(`["Sword of Honour","The Lord of the Rings"]`)},
+		// field presence
+		{`$.store.book[?(@.isbn)].title`, []byte(`["Moby Dick","The Lord of the Rings"]`)},
+		// string match
+		{`$.store.book[?(@.isbn == "0-553-21311-3")].title`, []byte(`["Moby Dick"]`)},
+		// string mismatch
+		// books lacking isbn do not equal it either
+		{`$.store.book[?(@.isbn != "0-553-21311-3")].title`, []byte(`["Sayings of the Century","Sword of Honour","The Lord of the Rings"]`)},
+		{`$.store.book[?(@.isbn && @.isbn != "0-553-21311-3")].title`, []byte(`["The Lord of the Rings"]`)},
+		// root references
+		{`$.store.book[?(@.price > $.expensive)].title`, []byte(`["Sword of Honour","The Lord of the Rings"]`)},
+		// math +
+		{`$.store.book[?(@.price > $.expensive+1)].price`, []byte(`[12.99,22.99]`)},
+		// math -
+		{`$.store.book[?(@.price > $.expensive-1)].price`, []byte(`[12.99,22.99]`)},
+		// math *
+		{`$.store.book[?(@.price > $.expensive*1.1)].price`, []byte(`[12.99,22.99]`)},
+		// math /
+		{`$.store.book[?(@.price > $.expensive/0.7)].price`, []byte(`[22.99]`)},
+		// logic operators : AND
+		{`$.store.book[?(@.price > $.expensive && @.isbn)].title`, []byte(`["The Lord of the Rings"]`)},
+		// logic operators : OR
+		{`$.store.book[?(@.price >= $.expensive || @.isbn)].title`, []byte(`["Moby Dick","The Lord of the Rings"]`)},
+		// logic operators : AND/OR numbers, strings
+		{`$.store.book[?(@.price || @.isbn != "")].title`, []byte(`["Sayings of the Century","Sword of Honour","Moby Dick","The Lord of the Rings"]`)},
+		// logic operators : same as above, for coverage's sake
+		{`$.store.book[?(@.isbn != "" || @.price)].title`, []byte(`["Sayings of the Century","Sword of Honour","Moby Dick","The Lord of the Rings"]`)},
+		// non-empty field
+		{`$.store.book[?(@.price)].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
+		// bool ==
+		{`$.store.book[?($.store.open == true)].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
+		// bool !=
+		{`$.store.book[?($.store.open != false)].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
+		// bool <
+		{`$.store.book[?($.store.open > false)].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
+		// bool >
+		{`$.store.book[?($.store.open < true)].price`, []byte(``)},
+		// escaped chars
+		{`$.store.bicycle.equipment[?(@[0] == "\"quoted\"")]`, []byte(`[["\"quoted\""]]`)},
+		// numbers
+		{`$.store.book[?(20 <= @.price)].title`, []byte(`["The Lord of the Rings"]`)},
+		// numbers (+)
+		{`$.store.book[?(@.price != 22.99)].price`, []byte(`[8.95,12.99,8.99]`)},
+
+		// regexp
+		{`$.store.book[?(@.title =~ /the/i)].title`, []byte(`["Sayings of the Century","The Lord of the Rings"]`)},
+		// regexp
+		{`$.store.book[?(@.title =~ /(Saying)|(Lord)/)].title`, []byte(`["Sayings of the Century","The Lord of the Rings"]`)},
+
+		// array of arrays
+		{`$.store.bicycle.equipment[1][0]`, []byte(`"peg leg"`)},
+		// filter expression not found -- not an error
+		{`$.store.book[?($.store[0] > 0)]`, []byte(`[]`)},
+		// wildcard: any key within an object
+		{`$.store.book[0].*`, []byte(`["reference","Nigel Rees","Sayings of the Century",8.95]`)},
+		// wildcard: named key on a given level
+		{`$.store.*.price`, []byte(`[19.95]`)},
+		// wildcard: named key in any array on a given level
+		{`$.store.*[:].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
+
+		// all elements of an empty array is an empty array
+		{`$.store.manager[:]`, []byte(`[]`)},
+
+		// multiple keys (ordered as in query)
+		{`$.store.book[:]['price','title']`, []byte(`[[8.95,"Sayings of the Century"],[12.99,"Sword of Honour"],[8.99,"Moby Dick"],[22.99,"The Lord of the Rings"]]`)},
+		// multiple keys combined with filter
+		{`$.store.book[?(@.price > $.expensive*1.1)]['price','title']`, []byte(`[[12.99,"Sword of Honour"],[22.99,"The Lord of the Rings"]]`)},
+
+		// functions in filter
+		{`$.store.bicycle.equipment[?(@.count() == 2)][1]`, []byte(`["apparel"]`)},
+
+		// functions applied to a filtered or sliced array
+		{`$.store.book[?(@.price > 10)].count()`, []byte(`2`)},
+		{`$.store.book[?(@.isbn)].length()`, []byte(`2`)},
+		{`$.store.book[?(@.price > 100)].count()`, []byte(`0`)},
+		{`$.store.book[1:].length()`, []byte(`3`)},
+		{`$.store.bicycle.equipment[0].count()`, []byte(`3`)},
+
+		// nth element, negative counts from the end
+		{`$.store.bicycle.equipment.nth(0)`, []byte(`["paddles", "umbrella", "horn"]`)},
+		{`$.store.bicycle.equipment.nth(2)`, []byte(`["light saber", "apparel"]`)},
+		{`$.store.bicycle.equipment.nth(-2)`, []byte(`["light saber", "apparel"]`)},
+		{`$.store.bicycle.equipment[1].nth( -3 )`, []byte(`"peg leg"`)},
+		{`$.store.book[?(@.price > 10)].nth(-1)`, []byte(`{
+						"category": "fiction",
+						"author": "J. R. R. Tolkien",
+						"title": "The Lord of the Rings",
+						"isbn": "0-395-19395-8",
+						"price": 22.99
+					}`)},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(data, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_Fixes(t *testing.T) {
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected []byte
+	}{
+		// closing square bracket inside a string value has been mistakenly taken as an array bound
+		{[]byte(`{"foo":["[]"],"bar":123}`), `$.bar`, []byte(`123`)},
+
+		// key list: values are returned in the order requested, not in document order
+		{[]byte(`{"a":1, "c":3, "b":2}`), `$['b','a']`, []byte(`[2,1]`)},
+		{[]byte(`{"a":1, "c":3, "b":2}`), `$['c','b','a']`, []byte(`[3,2,1]`)},
+		{[]byte(`{"x":{"b":2, "a":1}}`), `$.x['a','b']`, []byte(`[1,2]`)},
+		// key list: missing keys are omitted
+		{[]byte(`{"a":1, "c":3, "b":2}`), `$['b','z','a']`, []byte(`[2,1]`)},
+		// key list: empty key in the document is not a hit
+		{[]byte(`{"":0, "a":1, "b":2}`), `$['b','a']`, []byte(`[2,1]`)},
+
+		// wildcard: all elements of a top-level array
+		{[]byte(`[1, {"a":2}, [3,4], "x"]`), `$.*`, []byte(`[1,{"a":2},[3,4],"x"]`)},
+		// wildcard: all values of a top-level object
+		{[]byte(`{"a":1, "b":{"c":2}, "d":"x"}`), `$.*`, []byte(`[1,{"c":2},"x"]`)},
+		// wildcard: array elements of a nested array
+		{[]byte(`{"a":[{"n":1},{"n":2},{"m":3}]}`), `$.a.*.n`, []byte(`[1,2]`)},
+		// wildcard: empty array
+		{[]byte(`[]`), `$.*`, []byte(`[]`)},
+		// wildcard: indexed element missing in every array
+		{[]byte(`{"a":[1],"b":[2]}`), `$.*[5]`, []byte(`[]`)},
+		// a single bracket-notated key is a plain child, the path may go on after it
+		{[]byte(`{"a":{"b":[5,6]},"b":0}`), `$['a']`, []byte(`{"b":[5,6]}`)},
+		{[]byte(`{"a":{"b":[5,6]},"b":0}`), `$['a'].b[1]`, []byte(`6`)},
+		{[]byte(`{"a":{"b":[5,6]},"b":0}`), `$.a['b']`, []byte(`[5,6]`)},
+		// escaped quotes in keys
+		{[]byte(`{"a\"b": 1, "c": 2}`), `$['a\"b']`, []byte(`1`)},
+		{[]byte(`{"a\"b": 1, "c": 2}`), `$.c`, []byte(`2`)},
+		{[]byte(`{"a\\": 1, "c": 2}`), `$.c`, []byte(`2`)},
+		{[]byte(`{"x\"": {"y": 3}}`), `$['x\"','z']`, []byte(`[{"y": 3}]`)},
+		{[]byte(`{"it's": 1, "x\\": 2}`), `$['it\'s']`, []byte(`1`)},
+		{[]byte(`{"it's": 1, "x\\": 2}`), `$['x\\','it\'s']`, []byte(`[2,1]`)},
+		// whitespace around the path is ignored
+		{[]byte(`{"a":{"b":1}}`), "  $.a.b  ", []byte(`1`)},
+		{[]byte(`{"a":{"b":1}}`), "\t$.a.b\n", []byte(`1`)},
+		{[]byte(`{"a":{"b":1}}`), " $ ", []byte(`{"a":{"b":1}}`)},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_ObjectLength(t *testing.T) {
+
+	doc := []byte(`{"records":[{"a":1},{"a":1,"b":2,"c":3},{"a":1,"b":{"x":1,"y":2,"z":3}},{}],"n":1}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.records[1].length()`, `3`},
+		{`$.records[3].count()`, `0`},
+		{`$.records[?(@.length() > 2)]`, `[{"a":1,"b":2,"c":3}]`},
+		{`$.records[?(@.length() <= 2)].a`, `[1,1]`},
+		{`$.records[?(@.count() == 0)]`, `[{}]`},
+		{`$.records[?(@.b.length() == 3)].a`, `[1]`},
+		{`$.n.length()`, `length() is only applicable to array, object or string`},
+	})
+}
+
+func Test_AggregateFunctions(t *testing.T) {
+
+	doc := []byte(`{"prices":[3, 1.50, 10, -2e1],"empty":[],"mixed":[1,"2"],"orders":[{"q":[1,2]},{"q":[5]}],"huge":[1e308,1e308]}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.prices.min()`, `-2e1`},
+		{`$.prices.max()`, `10`},
+		{`$.prices.sum()`, `-5.5`},
+		{`$.prices.avg()`, `-1.375`},
+		{`$.prices[:2].sum()`, `4.5`},
+		{`$.empty.sum()`, `0`},
+		{`$.empty.avg()`, `null`},
+		{`$.empty.min()`, `null`},
+		{`$.orders[?(@.q.sum() > 2)]`, `[{"q":[1,2]},{"q":[5]}]`},
+		{`$.orders[?(@.q.max() == 5)]`, `[{"q":[5]}]`},
+		{`$.orders[*].q.max()`, `[2,5]`},
+		{`$.mixed.sum()`, `invalid operands for arithmetic operator`},
+		{`$.orders.avg()`, `invalid operands for arithmetic operator`},
+		{`$.prices[0].sum()`, `array expected`},
+		{`$.prices.sum(1)`, `path: invalid function argument at 13`},
+		{`$.huge.sum()`, `invalid operands for arithmetic operator`},
+		{`$.huge.avg()`, `invalid operands for arithmetic operator`},
+		{`$.huge.max()`, `1e308`},
+		// function names are case insensitive
+		{`$.prices.SUM()`, `-5.5`},
+		{`$.prices.Min()`, `-2e1`},
+	})
+
+	// built-ins can not be registered whatever the case
+	for _, name := range []string{"min", "max", "sum", "avg", "Avg"} {
+		if err := RegisterFunc(name, func(value []byte) ([]byte, error) { return value, nil }); err != errFuncRegistered {
+			t.Errorf("RegisterFunc : %s() is a built-in, got %v", name, err)
+		}
+	}
+}
+
+func Test_FirstLast(t *testing.T) {
+
+	doc := []byte(`{"events":[{"type":"view","id":1},{"type":"click","id":2},{"type":"click","id":3}],"empty":[],"obj":{"a":1}}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.events[?(@.type=='click')].first()`, `{"type":"click","id":2}`},
+		{`$.events[?(@.type=='click')].last()`, `{"type":"click","id":3}`},
+		{`$.events.first()`, `{"type":"view","id":1}`},
+		{`$.events.last()`, `{"type":"click","id":3}`},
+		{`$.events[:2].last()`, `{"type":"click","id":2}`},
+		{`$.events[?(@.type=='x')].first()`, `specified array element not found`},
+		{`$.empty.last()`, `specified array element not found`},
+		{`$.obj.first()`, `array expected`},
+		{`$.events.first(1)`, `path: invalid function argument at 15`},
+	})
+
+	if err := RegisterFunc("last", func(value []byte) ([]byte, error) { return value, nil }); err == nil {
+		t.Errorf("RegisterFunc : last() is a built-in")
+	}
+}
+
+func Test_FilterFunctionOperands(t *testing.T) {
+
+	orders := []byte(`{"orders":[
+		{"id":1, "items":[1,2,3], "minItems":2, "tags":["a","b","c"]},
+		{"id":2, "items":[1], "minItems":2, "tags":[]},
+		{"id":3, "items":[], "minItems":0, "tags":["x"]}
+	]}`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected []byte
+	}{
+		// function on the left, field on the right
+		{orders, `$.orders[?(@.items.length() > @.minItems)].id`, []byte(`[1]`)},
+		// field on the left, function on the right
+		{orders, `$.orders[?(@.minItems <= @.items.length())].id`, []byte(`[1,3]`)},
+		// functions on both sides
+		{orders, `$.orders[?(@.items.length() == @.tags.count())].id`, []byte(`[1]`)},
+		// missing field never matches
+		{orders, `$.orders[?(@.items.length() > @.maxItems)].id`, []byte(``)},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_FilterNestedArrays(t *testing.T) {
+
+	orders := []byte(`{"orders":[
+		{"id":1, "items":[{"status":"open"},{"status":"paid"}], "status":"closed"},
+		{"items":[], "id":2, "status":"open"},
+		{"id":3, "items":[[{"status":"open"}]], "meta":{"status":"open"}},
+		{"id":4, "items":["status","open"], "status":"open"}
+	]}`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected []byte
+	}{
+		// top-level field, nested arrays containing the same key do not interfere
+		{orders, `$.orders[?(@.status == "open")].id`, []byte(`[2,4]`)},
+		{orders, `$.orders[?(@.status)].id`, []byte(`[1,2,4]`)},
+		// a key is never looked up inside an array
+		{orders, `$.orders[?(@.items[0].status == "open")].id`, []byte(`[1]`)},
+		{orders, `$.orders[?(@.meta.status == "open")].id`, []byte(`[3]`)},
+		{orders, `$.orders[?(@.items.length() > 1)].id`, []byte(`[1,4]`)},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_FilterType(t *testing.T) {
+
+	mixed := []byte(`{"values":[1, "two", {"three":3}, [4], null, true, -5.5e1], "refs":[{"a":1},{"a":"x"},{}]}`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected []byte
+	}{
+		{mixed, `$.values[?(type(@) == 'number')]`, []byte(`[1,-5.5e1]`)},
+		{mixed, `$.values[?(type(@) == 'string')]`, []byte(`["two"]`)},
+		{mixed, `$.values[?(type(@) == 'object' || type( @ ) == 'array')]`, []byte(`[{"three":3},[4]]`)},
+		{mixed, `$.values[?(type(@) == 'boolean')]`, []byte(`[true]`)},
+		{mixed, `$.values[?(type(@) == 'null')]`, []byte(`[null]`)},
+		{mixed, `$.values[?(type(@) != 'number')]`, []byte(`["two",{"three":3},[4],null,true]`)},
+		// type of a field, missing fields do not match
+		{mixed, `$.refs[?(type(@.a) == 'string')]`, []byte(`[{"a":"x"}]`)},
+		// type of a root reference
+		{mixed, `$.refs[?(type($.values) == 'array')].a`, []byte(`[1,"x"]`)},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+
+	if _, err := Get(mixed, `$.values[?(typo(@) == 'number')]`); err == nil || err.Error() != "path: unknown function at 11" {
+		t.Errorf("typo(@) : unknown function error expected, got %v", err)
+	}
+}
+
+func Test_FilterEquality(t *testing.T) {
+
+	// x is absent, null, equal, unequal, of another type
+	items := []byte(`[{"id":1},{"id":2,"x":null},{"id":3,"x":5},{"id":4,"x":6},{"id":5,"x":"5"}]`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected []byte
+	}{
+		{items, `$[?(@.x == 5)].id`, []byte(`[3]`)},
+		{items, `$[?(@.x != 5)].id`, []byte(`[1,2,4,5]`)},
+		{items, `$[?(@.x == '5')].id`, []byte(`[5]`)},
+		{items, `$[?(@.x != '5')].id`, []byte(`[1,2,3,4]`)},
+		// an absent value equals null
+		{items, `$[?(@.x == null)].id`, []byte(`[1,2]`)},
+		{items, `$[?(@.x != null)].id`, []byte(`[3,4,5]`)},
+		{items, `$[?(null != @.x)].id`, []byte(`[3,4,5]`)},
+		// ordering is not defined for null
+		{[]byte(`[{"id":1},{"id":2,"x":null},{"id":3,"x":5},{"id":4,"x":6}]`), `$[?(@.x >= 5)].id`, []byte(`[3,4]`)},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_FilterPosition(t *testing.T) {
+
+	items := []byte(`{"items":[0, 1, 2, 3, 4, 5, 6, 7, 8, 9], "odd":[{"n":1},{"n":3},{"n":5}]}`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected []byte
+	}{
+		// last three elements regardless of the array size
+		{items, `$.items[?(@index >= @length - 3)]`, []byte(`[7,8,9]`)},
+		{items, `$.odd[?(@index >= @length - 3)].n`, []byte(`[1,3,5]`)},
+		{items, `$.items[?(@index < 2 || @index == @length-1)]`, []byte(`[0,1,9]`)},
+		{items, `$.odd[?(@index == 1)].n`, []byte(`[3]`)},
+		{items, `$.odd[?(@.n > @index * 2)].n`, []byte(`[1,3,5]`)},
+		// @ alone is still the element itself
+		{items, `$.items[?(@ == @index + 0)].length()`, []byte(`10`)},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_FilterNegativeIndex(t *testing.T) {
+
+	rows := []byte(`{"rows":[{"id":1,"cells":["a","X"]},{"id":2,"cells":["X","b"]},{"id":3,"cells":[]},{"id":4},{"id":5,"cells":["X"]}]}`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected []byte
+	}{
+		// indexes are resolved against the length of each element's array
+		{rows, `$.rows[?(@.cells[-1] == 'X')].id`, []byte(`[1,5]`)},
+		{rows, `$.rows[?(@.cells[-2] == 'X')].id`, []byte(`[2]`)},
+		{rows, `$.rows[?(@.cells[-1])].id`, []byte(`[1,2,5]`)},
+		// out of range: no match
+		{rows, `$.rows[?(@.cells[-3] == 'X')].id`, []byte(``)},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_FilterIn(t *testing.T) {
+
+	users := []byte(`{"users":[
+		{"id":1, "roles":["admin","dev"]},
+		{"id":2, "roles":["dev"]},
+		{"id":3},
+		{"id":4, "roles":"admin"},
+		{"id":5, "roles":[1, 2, "admin "]},
+		{"id":6, "roles":[[], {"a":1}, 3]}
+	]}`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected []byte
+	}{
+		{users, `$.users[?('admin' in @.roles)].id`, []byte(`[1]`)},
+		{users, `$.users[?("dev" in @.roles)].id`, []byte(`[1,2]`)},
+		{users, `$.users[?(3 in @.roles)].id`, []byte(`[6]`)},
+		{users, `$.users[?('dev' in @.roles && @.id > 1)].id`, []byte(`[2]`)},
+		{users, `$.users[?('guest' in @.roles)].id`, []byte(``)},
+		// array fields still work as existence checks
+		{users, `$.users[?(@.roles)].id`, []byte(`[1,2,4,5,6]`)},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_InList(t *testing.T) {
+
+	doc := []byte(`{"items":[{"s":"active","n":1},{"s":"pending","n":2},{"s":"done","n":3},{"n":4}]}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.items[?(@.s in ['active','pending'])].n`, `[1,2]`},
+		{`$.items[?(@.s in [ "done" , 'active' ])].n`, `[1,3]`},
+		{`$.items[?(@.n in [1,3])].n`, `[1,3]`},
+		{`$.items[?(@.n in [])]`, `[]`},
+		{`$.items[?(@.s nin ['active','pending'])].n`, `[3,4]`},
+		{`$.items[?(@.n nin [])].n`, `[1,2,3,4]`},
+		{`$.items[?(@.n > 1 && @.s nin ['done'])].n`, `[2,4]`},
+		{`$.items[?(@.s in ['ACTIVE'])]`, `[]`},
+		{`$.items[?(@.n in [1,x])]`, `unrecognized value: true, false or null expected at 20`},
+		{`$.items[?(@.n in [1+1])]`, `',' or ']' expected in list at 19`},
+		{`$.items[?(@.s in ['b' 'c'])]`, `',' or ']' expected in list at 22`},
+		{`$.items[?(@.n in [1,])]`, `unrecognized value: true, false or null expected at 20`},
+		{`$.items[?(@.s in ['it\'s', 'a"b'])]`, `[]`},
+		{`$.items[?(@.s in [null])].n`, `[4]`},
+		{`$.items[?(@.s nin [null])].n`, `[1,2,3]`},
+		{`$.items[?(@.x in ['a'])]`, `[]`},
+		{`$.items[?(@.x nin ['a'])].n`, `[1,2,3,4]`},
+	})
+
+	res, err := GetWithOptions(doc, `$.items[?(@.s in ['ACTIVE'])].n`, &Options{CaseInsensitiveValues: true})
+	if err != nil || string(res) != `[1]` {
+		t.Errorf("CaseInsensitiveValues : unexpected %s (%v)", res, err)
+	}
+}
+
+func Test_CaseInsensitiveValues(t *testing.T) {
+
+	doc := []byte(`{"allowed":["ACTIVE","Inactive"],"items":[{"id":1,"status":"ACTIVE"},{"id":2,"status":"Active"},{"id":3,"status":"inactive"},{"id":4,"status":"active"}]}`)
+
+	tests := []struct {
+		Fold     bool
+		Query    string
+		Expected string
+	}{
+		{false, `$.items[?(@.status == 'active')].id`, `[4]`},
+		{true, `$.items[?(@.status == 'active')].id`, `[1,2,4]`},
+		{false, `$.items[?(@.status != 'active')].id`, `[1,2,3]`},
+		{true, `$.items[?(@.status != 'active')].id`, `[3]`},
+		{false, `$.items[?(@.status in $.allowed)].id`, `[1]`},
+		{true, `$.items[?(@.status in $.allowed)].id`, `[1,2,3,4]`},
+		{true, `$.items[?(@.status =~ /^act/)].id`, `[4]`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions(doc, tst.Query, &Options{CaseInsensitiveValues: tst.Fold})
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + " (fold " + strconv.FormatBool(tst.Fold) + ")\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_CompoundFilters(t *testing.T) {
+
+	doc := []byte(`{"events":[
+		{"id":1,"type":"click","target":{"id":"btn"}},
+		{"id":2,"type":"click","target":{"id":"link"}},
+		{"id":3,"type":"hover","target":{"id":"btn"}},
+		{"id":4,"type":"click"},
+		{"id":5,"type":"click","target":"btn"},
+		{"id":6,"target":{"id":"btn"}},
+		{"id":7,"type":"click","target":{"id":"btn","n":2}}
+	]}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		// a top-level field and a nested-path field
+		{`$.events[?(@.type == 'click' && @.target.id == 'btn')].id`, `[1,7]`},
+		{`$.events[?(@.target.id == 'btn' && @.type == 'click')].id`, `[1,7]`},
+		{`$.events[?(@.type == 'click' && @.target.id != 'btn')].id`, `[2,4,5]`},
+		{`$.events[?(@.type == 'hover' || @.target.id == 'link')].id`, `[2,3]`},
+		{`$.events[?(@.type == 'hover' || @.target.id == 'link' && @.type == 'click')].id`, `[2,3]`},
+		{`$.events[?(@.type == 'click' && @.target.id == 'btn' && @.target.n > 1)].id`, `[7]`},
+		// a missing field makes the whole expression false
+		{`$.events[?(@.target.n || @.type == 'hover')].id`, `[7]`},
+		{`$.events[?(@.type == 'hover' || @.target.n)].id`, `[7]`},
+		{`$.events[?(@.target.n && @.type == 'click')].id`, `[7]`},
+		{`$.events[?(@.target.x && @.type == 'click')].id`, ``},
+		// the right operand is not evaluated once the result is known
+		// (the right operand is an invalid arithmetic which would fail the filter)
+		{`$.events[?(@.id > 0 || @.target.id + 1 > 0)].id`, `[1,2,3,4,5,6,7]`},
+		{`$.events[?(@.id < 0 && @.target.id + 1 > 0)].id`, ``},
+		{`$.events[?(@.target.x && @.target.id + 1 > 0)].id`, ``},
+		{`$.events[?(@.target.x || @.target.id + 1 > 0)].id`, ``},
+	})
+}
+
+func Test_RootReferences(t *testing.T) {
+
+	doc := []byte(`{"a":[{"id":1,"x":5,"t":[{"x":1},{"x":2}]},{"id":2,"x":6,"t":[{"x":3}]},{"id":3,"x":5,"t":[]}],"ref":3}`)
+	arr := []byte(`[{"x":1,"y":"a"},{"x":2,"y":"b"},{"x":1,"y":"c"}]`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected string
+	}{
+		// $ is the whole document, not the array being filtered
+		{doc, `$.a[?(@.x == $.a[0].x)].id`, `[1,3]`},
+		{doc, `$.a[?(@.x != $.a[0].x)].id`, `[2]`},
+		{doc, `$..a[?(@.x == $.a[-1].x)].id`, `[1,3]`},
+		{arr, `$[?(@.x == $[0].x)].y`, `["a","c"]`},
+		{arr, `$[?(@.x == $[1].x)].y`, `["b"]`},
+		// filters nested in filters
+		{doc, `$.a[?(@.t[?(@.x == $.ref)].length() > 0)].id`, `[2]`},
+		{doc, `$.a[?(@.t[?(@.x == $.a[0].t[1].x)].count() == 1)].id`, `[1]`},
+		{doc, `$.a[?(@.t[?(@.x > 100)].length() > 0)].id`, ``},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_AbsoluteFunctions(t *testing.T) {
+
+	doc := []byte(`{"items":[{"id":1,"votes":1},{"id":2,"votes":3},{"id":3,"votes":2},{"id":4,"votes":0}],"tags":{"a":1,"b":2},"name":"ab"}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		// the threshold is derived from the length of the array being filtered
+		{`$.items[?(@.votes > $.items.length() / 2)].id`, `[2]`},
+		{`$.items[?(@.votes >= $.items.length() / 2)].id`, `[2,3]`},
+		{`$.items[?(@.votes < $.items.count() - 2)].id`, `[1,4]`},
+		{`$.items[?(@.votes * 2 > $.items.length())].id`, `[2]`},
+		{`$.items[?($.items.length() == 4)].id`, `[1,2,3,4]`},
+		// functions of other values
+		{`$.items[?(@.votes == $.tags.length())].id`, `[3]`},
+		{`$.items[?(@.votes > $.items[?(@.votes > 0)].length() - 2)].id`, `[2,3]`},
+		// an absolute operand filtered by an absolute function
+		{`$.items[?(@.votes > $.items[?(@.votes >= $.items.length() / 2)].length())].id`, `[2]`},
+	})
+}
+
+func Test_SizeFilter(t *testing.T) {
+
+	doc := []byte(`{"items":[{"id":1},{"id":2,"note":"a rather long note"},"short","a much longer string",[1,2,3],{"id":3,"tags":["x","y"]}]}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.items[?(size(@) > 20)]`, `[{"id":2,"note":"a rather long note"},"a much longer string",{"id":3,"tags":["x","y"]}]`},
+		{`$.items[?(size(@) <= 8)]`, `[{"id":1},"short",[1,2,3]]`},
+		{`$.items[?(size(@) == 7)]`, `["short",[1,2,3]]`},
+		{`$.items[?(size(@.tags) > 5)].id`, `[3]`},
+		{`$.items[?(size(@.note) > 0)].id`, `[2]`},
+		{`$.items[?(size(@) == @.id)]`, `[]`},
+		{`$.items[?(size(@) > 10 && @.id)].id`, `[2,3]`},
+	})
+}
+
+func Test_RegexpElements(t *testing.T) {
+
+	doc := []byte(`{"lines":["INFO start","ERROR disk full","WARN low space","error: retrying","INFO ERROR cleared"],"codes":["a1","b22","c333"]}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.lines[?(@ =~ /ERROR/)]`, `["ERROR disk full","INFO ERROR cleared"]`},
+		{`$.lines[?(@ =~ /^ERROR/)]`, `["ERROR disk full"]`},
+		{`$.lines[?(@ =~ /error/i)]`, `["ERROR disk full","error: retrying","INFO ERROR cleared"]`},
+		{`$.lines[?(@ =~ /^INFO/ && @ =~ /ERROR/)]`, `["INFO ERROR cleared"]`},
+		{`$.lines[?(@ =~ /FATAL/)]`, `[]`},
+		{`$.codes[?(@ =~ /^[a-z][0-9]{2,}$/)]`, `["b22","c333"]`},
+		{`$.lines[?(@ =~ /ERROR/)].length()`, `2`},
+	})
+}
+
+func Test_RegexpFlags(t *testing.T) {
+
+	doc := []byte(`{"names":[{"name":"John Smith"},{"name":"johnny"},{"name":"Bob Johnson"}]}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.names[?(@.name =~ /john/i)].name`, `["John Smith","johnny","Bob Johnson"]`},
+		{`$.names[?(@.name =~ /john/)].name`, `["johnny"]`},
+		{`$.names[?(@.name =~ /^JOHN/i)].name`, `["John Smith","johnny"]`},
+		{`$.names[?(@.name =~ /^john.*h/iU)].name`, `["John Smith"]`},
+		{`$.names[?(@.name =~ /JOHN/i && @.name =~ /y$/)].name`, `["johnny"]`},
+		{`$.names[?(@.name =~ /john/x)].name`, `unknown regexp flag: i, m, s or U expected at 26`},
+		{`$.names[?(@.name =~ /john/ix)].name`, `unknown regexp flag: i, m, s or U expected at 27`},
+	})
+}
+
+func Test_GetFirst(t *testing.T) {
+
+	input := []byte(`{"v2": {"user": {"name": "Alice"}}, "list": [1]}`)
+
+	tests := []struct {
+		Paths    []string
+		Expected []byte
+		Matched  string
+		Error    string
+	}{
+		// first path misses, second hits
+		{[]string{`$.v1.name`, `$.v2.user.name`}, []byte(`"Alice"`), `$.v2.user.name`, ``},
+		// first path hits
+		{[]string{`$.v2.user.name`, `$.list[0]`}, []byte(`"Alice"`), `$.v2.user.name`, ``},
+		// missing array element falls through
+		{[]string{`$.list[5]`, `$.list[0]`}, []byte(`1`), `$.list[0]`, ``},
+		// nothing matches
+		{[]string{`$.v1`, `$.v3`}, nil, ``, `specified array element not found`},
+		// structural errors abort
+		{[]string{`$.v2.user[0]`, `$.list[0]`}, nil, ``, `array expected`},
+		// path errors abort
+		{[]string{`$.v1(`, `$.list[0]`}, nil, ``, `path: invalid element reference at 4`},
+		// no paths
+		{nil, nil, ``, `path: empty`},
+	}
+
+	for _, tst := range tests {
+		res, path, err := GetFirst(input, tst.Paths...)
+		if tst.Error != "" {
+			if err == nil || err.Error() != tst.Error {
+				t.Errorf("%v\n\texpected error `%s`\n\tbut got  `%v`", tst.Paths, tst.Error, err)
+			}
+		} else if err != nil {
+			t.Errorf("%v : %s", tst.Paths, err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 || path != tst.Matched {
+			t.Errorf("%v\n\texpected `%s` from %s\n\tbut got  `%s` from %s", tst.Paths, tst.Expected, tst.Matched, res, path)
+		}
+	}
+}
+
+func Test_Lookup(t *testing.T) {
+
+	doc := []byte(`{"a":{"b":[1,2]},"c":null,"s":"str","e":[]}`)
+
+	tests := []struct {
+		Data  []byte
+		Query string
+		Value string
+		Found bool
+		Error string
+	}{
+		// found
+		{doc, `$.a.b`, `[1,2]`, true, ``},
+		{doc, `$.a.b[1]`, `2`, true, ``},
+		{doc, `$.c`, `null`, true, ``},
+		{doc, `$.e`, `[]`, true, ``},
+		{doc, `$..b`, `[[1,2]]`, true, ``},
+		{doc, `$.a.b.length()`, `2`, true, ``},
+		// not found
+		{doc, `$.x`, ``, false, ``},
+		{doc, `$.a.x`, ``, false, ``},
+		{doc, `$.a.b[5]`, ``, false, ``},
+		{doc, `$.a.b[?(@ > 5)]`, ``, false, ``},
+		{doc, `$..x`, ``, false, ``},
+		{doc, `$.s.x`, ``, false, ``},
+		{doc, `$.a[0]`, ``, false, ``},
+		{doc, `$.a.b.x`, ``, false, ``},
+		// malformed
+		{doc, `$.a[`, ``, false, `path: index bound missing at 4`},
+		{doc, `a.b`, ``, false, `path: $ expected`},
+		{[]byte(`{"a":`), `$.a`, ``, false, `unexpected end of input`},
+		{[]byte(`{"a" 1}`), `$.a`, ``, false, `':' expected`},
+	}
+
+	for _, tst := range tests {
+		value, found, err := Lookup(tst.Data, tst.Query)
+		errText := ""
+		if err != nil {
+			errText = err.Error()
+		}
+		if string(value) != tst.Value || found != tst.Found || errText != tst.Error {
+			t.Errorf(tst.Query+"\n\texpected `"+tst.Value+"` %v `"+tst.Error+"`\n\tbut got  `"+string(value)+"` %v `"+errText+"`", tst.Found, found)
+		}
+	}
+}
+
+func Test_GetMatchingKeys(t *testing.T) {
+
+	input := []byte(`{"a": 0, "c": null, "x": {"b": false}, "list": [{"b": ""}]}`)
+
+	tests := []struct {
+		Query    string
+		Expected []string
+		Error    string
+	}{
+		// only some of the keys exist, falsy values count as present
+		{`$['a','b','c']`, []string{"a", "c"}, ``},
+		{`$['c','a']`, []string{"c", "a"}, ``},
+		{`$.x['a','b','c']`, []string{"b"}, ``},
+		{`$.list[0]['a','b']`, []string{"b"}, ``},
+		{`$['y','z']`, []string{}, ``},
+		// single key
+		{`$.x.b`, []string{"b"}, ``},
+		{`$.x.z`, []string{}, ``},
+		// errors
+		{`$.list['a','b']`, nil, `object expected`},
+		{`$.list[0]`, nil, `path: key list expected`},
+		{`$.x.*`, nil, `path: key list expected`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetMatchingKeys(input, tst.Query)
+		if tst.Error != "" {
+			if err == nil || err.Error() != tst.Error {
+				t.Errorf(tst.Query+"\n\texpected error `%s`\n\tbut got  `%v`", tst.Error, err)
+			}
+		} else if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if fmt.Sprint(res) != fmt.Sprint(tst.Expected) {
+			t.Errorf(tst.Query+"\n\texpected `%v`\n\tbut got  `%v`", tst.Expected, res)
+		}
+	}
+}
+
+func Test_RootToken(t *testing.T) {
+
+	tests := []struct {
+		Root     byte
+		Query    string
+		Expected []byte
+		Error    string
+	}{
+		{'%', `%.store.book[0].author`, []byte(`"Nigel Rees"`), ``},
+		{'%', `%.store.book[?(@.price > $.expensive)].price`, []byte(`[12.99,22.99]`), ``},
+		{'@', `@.store.book[?(@.price < 9)].title`, []byte(`["Sayings of the Century","Moby Dick"]`), ``},
+		{'@', `@`, data, ``},
+		{0, `$.expensive`, []byte(`10`), ``},
+		{'%', `$.expensive`, nil, `path: $ expected`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions(data, tst.Query, &Options{RootToken: tst.Root})
+		if tst.Error != "" {
+			if err == nil || err.Error() != tst.Error {
+				t.Errorf(tst.Query+"\n\texpected error `%s`\n\tbut got  `%v`", tst.Error, err)
+			}
+		} else if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_ImplicitRoot(t *testing.T) {
+
+	doc := []byte(`{"a":{"b":[1,2]},"c":[{"d":3}]}`)
+	arr := []byte(`[{"id":1},{"id":2}]`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected string
+	}{
+		{doc, `a.b`, `[1,2]`},
+		{doc, `a`, `{"b":[1,2]}`},
+		{doc, `a.b[0]`, `1`},
+		{doc, `c[0].d`, `3`},
+		{doc, `c[0]`, `{"d":3}`},
+		{doc, `['a'].b[-1]`, `2`},
+		{doc, `..d`, `[3]`},
+		{doc, ` a.b `, `[1,2]`},
+		{arr, `[0]`, `{"id":1}`},
+		{arr, `[1].id`, `2`},
+		{arr, `[?(@.id > 1)].id`, `[2]`},
+		// the root token is still accepted
+		{doc, `$.a.b`, `[1,2]`},
+		{doc, `$`, string(doc)},
+		// errors refer to the jsonpath as given
+		{doc, `a.b[`, `path: index bound missing at 4`},
+		{doc, `a.b.x`, `object expected`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions(tst.Data, tst.Query, &Options{ImplicitRoot: true})
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+
+	// not enabled by default
+	if _, err := Get(doc, `a.b`); err != errPathRootExpected {
+		t.Errorf("a.b : expected error %v, got %v", errPathRootExpected, err)
+	}
+}
+
+func Test_WithIndices(t *testing.T) {
+
+	input := []byte(`{"items":[{"id":0},{"id":1},{"id":2,"active":true},{"id":3},{"id":4},{"id":5,"active":true}]}`)
+	opts := &Options{WithIndices: true}
+
+	tests := []struct {
+		Query    string
+		Expected []byte
+	}{
+		{`$.items[?(@.active)]`, []byte(`[{"index":2,"value":{"id":2,"active":true}},{"index":5,"value":{"id":5,"active":true}}]`)},
+		{`$.items[?(@.id == 0)]`, []byte(`[{"index":0,"value":{"id":0}}]`)},
+		{`$.items[?(@.id > 10)]`, []byte(`[]`)},
+		// only terminal filters are annotated
+		{`$.items[?(@.active)].id`, []byte(`[2,5]`)},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions(input, tst.Query, opts)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_UnwrapSingle(t *testing.T) {
+
+	input := []byte(`{"items":[{"id":1,"tags":["a"]},{"id":2,"tags":[]},{"id":3,"tags":["b","c"]}]}`)
+	opts := &Options{UnwrapSingle: true}
+
+	tests := []struct {
+		Query    string
+		Expected []byte
+	}{
+		// one match
+		{`$.items[?(@.id == 1)]`, []byte(`{"id":1,"tags":["a"]}`)},
+		{`$.items[?(@.id == 1)].id`, []byte(`1`)},
+		{`$.items[1:2].id`, []byte(`2`)},
+		{`$.items.*.tags[1]`, []byte(`"c"`)},
+		{`$..tags[1]`, []byte(`"c"`)},
+		// zero or many matches
+		{`$.items[?(@.id > 5)].id`, []byte(``)},
+		{`$.items[?(@.id > 1)].id`, []byte(`[2,3]`)},
+		// not an aggregation: arrays are returned as is
+		{`$.items[0].tags`, []byte(`["a"]`)},
+		{`$.items[?(@.id == 1)].tags`, []byte(`["a"]`)},
+		{`$.items[?(@.id == 1)].count()`, []byte(`1`)},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions(input, tst.Query, opts)
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+		} else if compareSlices(res, tst.Expected) != 0 {
+			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_GetUnwrapped(t *testing.T) {
+
+	doc := []byte(`{"resp": {"data": {"result": {"id": 1, "n": 2}}}, "list": [{"item": {"a": 1}}], "one": {"x": {"y": 5}}}`)
+
+	tests := []queryTest{
+		{`$.resp`, `{"id": 1, "n": 2}`},
+		{`$.resp.data`, `{"id": 1, "n": 2}`},
+		{`$.list`, `[{"item": {"a": 1}}]`},
+		{`$.list[0]`, `1`},
+		{`$.one`, `5`},
+		{`$.one.x.y`, `5`},
+		{`$`, string(doc)},
+		{`$.missing`, `specified array element not found`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetUnwrapped(doc, tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf("%s\n\texpected `%s`\n\tbut got  `%s`", tst.Query, tst.Expected, res)
+		}
+	}
+
+	// the depth is limited
+	res, err := GetWithOptions(doc, `$.resp`, &Options{UnwrapEnvelopes: 1})
+	if err != nil || string(res) != `{"result": {"id": 1, "n": 2}}` {
+		t.Errorf("UnwrapEnvelopes 1 : unexpected %s (%v)", res, err)
+	}
+	res, err = GetWithOptions([]byte(`{"a":{"b":{"c":{"d":1}}}}`), `$`, &Options{UnwrapEnvelopes: 3})
+	if err != nil || string(res) != `{"d":1}` {
+		t.Errorf("UnwrapEnvelopes 3 : unexpected %s (%v)", res, err)
+	}
+}
+
+func Test_DuplicateKey(t *testing.T) {
+
+	input := []byte(`{"a":1, "b":{"c":0}, "a":2, "list":[{"x":1,"x":3}]}`)
+
+	tests := []struct {
+		Policy   DuplicateKeyPolicy
+		Query    string
+		Expected string
+	}{
+		{DuplicateKeyFirst, `$.a`, `1`},
+		{DuplicateKeyLast, `$.a`, `2`},
+		{DuplicateKeyError, `$.a`, `duplicate key`},
+		{DuplicateKeyFirst, `$['a','b']`, `[1,{"c":0}]`},
+		{DuplicateKeyLast, `$['a','b']`, `[2,{"c":0}]`},
+		{DuplicateKeyError, `$['a','b']`, `duplicate key`},
+		// unique keys are fine with any policy
+		{DuplicateKeyLast, `$.b.c`, `0`},
+		{DuplicateKeyError, `$.b.c`, `0`},
+		// a wildcard or a key pattern takes every value
+		{DuplicateKeyLast, `$.*`, `[1,{"c":0},2,[{"x":1,"x":3}]]`},
+		{DuplicateKeyError, `$.*.c`, `[0]`},
+		{DuplicateKeyError, `$.a*`, `[1,2]`},
+		// a member failing for another reason than missing the sub-path fails the wildcard
+		{DuplicateKeyError, `$.*[0].x`, `duplicate key`},
+		// filters follow the policy as well
+		{DuplicateKeyLast, `$.list[?(@.x == 3)].x`, `[3]`},
+		{DuplicateKeyFirst, `$.list[?(@.x == 3)].x`, ``},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions(input, tst.Query, &Options{DuplicateKey: tst.Policy})
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query+" (policy %d)\n\texpected `%s`\n\tbut got  `%s`", tst.Policy, tst.Expected, res)
+		}
+	}
+}
+
+func Test_GetWithMeta(t *testing.T) {
+
+	tests := []struct {
+		Query    string
+		Expected string
+		Type     string
+	}{
+		{`$.store.bicycle`, `{"color":"red","price":19.95}`, "object"},
+		{`$.store.book[1:3].price`, `[12.99,8.99]`, "array"},
+		{`$.store.bicycle.color`, `"red"`, "string"},
+		{`$.expensive`, `10`, "number"},
+		{`$.store.book.length()`, `4`, "number"},
+		{`$.store.open`, `true`, "boolean"},
+		{`$.store.branch`, `null`, "null"},
+	}
+
+	obj := []byte(`{"expensive":10,"store":{"open":true,"branch":null,"bicycle":{"color":"red","price":19.95},"book":[{"price":8.95},{"price":12.99},{"price":8.99},{"price":22.99}]}}`)
+	for _, tst := range tests {
+		res, typ, err := GetWithMeta(obj, tst.Query)
+		if err != nil || string(res) != tst.Expected || typ != tst.Type {
+			t.Errorf(tst.Query+"\n\texpected `%s` (%s)\n\tbut got  `%s` (%s) %v", tst.Expected, tst.Type, res, typ, err)
+		}
+	}
+
+	if _, typ, err := GetWithMeta(obj, `$.missing`); err != ErrArrayElementNotFound || typ != "" {
+		t.Errorf("GetWithMeta : not found expected, got %q (%v)", typ, err)
+	}
+}
+
+func Test_GetTime(t *testing.T) {
+
+	doc := []byte(`{"created":"2019-03-01T10:20:30+03:00","day":"2019-03-01","bad":"yesterday","num":1551424830}`)
+
+	tests := []struct {
+		Query    string
+		Layout   []string
+		Expected string
+	}{
+		{`$.created`, nil, `2019-03-01T07:20:30Z`},
+		{`$.day`, []string{"2006-01-02"}, `2019-03-01T00:00:00Z`},
+		{`$.day`, nil, `parsing time "2019-03-01" as "2006-01-02T15:04:05Z07:00": cannot parse "" as "T"`},
+		{`$.bad`, nil, `parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`},
+		{`$.num`, nil, `string expected`},
+		{`$.missing`, nil, `specified array element not found`},
+	}
+
+	for _, tst := range tests {
+		tm, err := GetTime(doc, tst.Query, tst.Layout...)
+		res := tm.UTC().Format(time.RFC3339)
+		if err != nil {
+			res = err.Error()
+		}
+		if res != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + res + "`")
+		}
+	}
+}
+
+func Test_GetJSONNumber(t *testing.T) {
+
+	doc := []byte(`{"amount":12345678901234567890.123456789012345,"id":9007199254740993,"exp":-1.5E+10,"name":"10","list":[1,2]}`)
+
+	tests := []struct {
+		Query    string
+		Expected json.Number
+	}{
+		{`$.amount`, `12345678901234567890.123456789012345`},
+		{`$.id`, `9007199254740993`},
+		{`$.exp`, `-1.5E+10`},
+		{`$.list[1]`, `2`},
+		{`$.list.length()`, `2`},
+		// not a number
+		{`$.name`, ``},
+		{`$.list`, ``},
+		{`$.missing`, ``},
+	}
+
+	for _, tst := range tests {
+		num, err := GetJSONNumber(doc, tst.Query)
+		if (err != nil) != (tst.Expected == "") || num != tst.Expected {
+			t.Errorf("%s : expected %q but got %q (%v)", tst.Query, tst.Expected, num, err)
+		}
+	}
+
+	num, _ := GetJSONNumber(doc, `$.id`)
+	if n, err := num.Int64(); err != nil || n != 9007199254740993 {
+		t.Errorf("$.id : unexpected %v (%v)", n, err)
+	}
+}
+
+func Test_GetIndexOr(t *testing.T) {
+
+	doc := []byte(`{"row":[10, 20, 30],"empty":[],"obj":{}}`)
+	def := []byte(`null`)
+
+	tests := []struct {
+		Query    string
+		Index    int
+		Expected string
+	}{
+		{`$.row`, 0, `10`},
+		{`$.row`, 2, `30`},
+		{`$.row`, 3, `null`},
+		{`$.row`, 100, `null`},
+		{`$.row`, -1, `30`},
+		{`$.row`, -3, `10`},
+		{`$.row`, -4, `null`},
+		{`$.empty`, 0, `null`},
+		{`$.empty`, -1, `null`},
+		{`$.obj`, 0, `array expected`},
+		{`$.missing`, 0, `specified array element not found`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetIndexOr(doc, tst.Query, tst.Index, def)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "[" + strconv.Itoa(tst.Index) + "]\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_GetHeadTail(t *testing.T) {
+
+	doc := []byte(`{"list":[1,2,3,4,5,6,7,8,9,10],"short":[1,2,3],"empty":[],"obj":{"a":1},"items":[{"id":1},{"id":2},{"id":3}]}`)
+
+	tests := []struct {
+		Query    string
+		Head     int
+		Tail     int
+		Expected string
+	}{
+		{`$.list`, 2, 2, `[1,2,9,10]`},
+		{`$.list`, 3, 0, `[1,2,3]`},
+		{`$.list`, 0, 3, `[8,9,10]`},
+		{`$.list`, 5, 5, `[1,2,3,4,5,6,7,8,9,10]`},
+		{`$.list`, 0, 0, `[]`},
+		// arrays shorter than head+tail are returned as is
+		{`$.short`, 2, 2, `[1,2,3]`},
+		{`$.short`, 5, 5, `[1,2,3]`},
+		{`$.empty`, 1, 1, `[]`},
+		{`$.short`, math.MaxInt, 1, `[1,2,3]`},
+		{`$.short`, 1, math.MaxInt, `[1,2,3]`},
+		{`$.items[*].id`, 1, 1, `[1,3]`},
+		{`$.obj`, 1, 1, `array expected`},
+		{`$.missing`, 1, 1, `error`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetHeadTail(doc, tst.Query, tst.Head, tst.Tail)
+		if err != nil {
+			res = []byte(err.Error())
+			if tst.Expected == "error" {
+				res = []byte("error")
+			}
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_DeepScan(t *testing.T) {
+
+	nested := []byte(`{"price":0,"items":[{"a":{"price":1}},[{"price":2},{"b":[{"price":3}]}]],"c":{"d":[[{"price":4}]]}}`)
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected string
+	}{
+		// objects inside arrays inside the root object
+		{nested, `$..price`, `[0,1,2,3,4]`},
+		{nested, `$.items..price`, `[1,2,3]`},
+		{nested, `$.items[1]..price`, `[2,3]`},
+		{nested, `$..b[0]`, `[{"price":3}]`},
+		{data, `$..price`, `[8.95,12.99,8.99,22.99,19.95]`},
+		{data, `$.store..price`, `[8.95,12.99,8.99,22.99,19.95]`},
+		{data, `$..book..price`, `[8.95,12.99,8.99,22.99]`},
+		{data, `$..book[?(@.price>10)].title`, `["Sword of Honour","The Lord of the Rings"]`},
+		{data, `$..missing`, `[]`},
+		// functions applied to every match
+		{nested, `$..b.length()`, `[1]`},
+		{nested, `$..d[0].length()`, `[1]`},
+		{data, `$..book[*].author.length()`, `[12,14,17,18]`},
+	}
+
+	for _, tst := range tests {
+		res, err := Get(tst.Data, tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+
+	spans, err := GetSpans(nested, `$..price`)
+	if err != nil || len(spans) != 5 || string(nested[spans[4][0]:spans[4][1]]) != "4" {
+		t.Errorf("GetSpans : unexpected %v (%v)", spans, err)
+	}
+}
+
+func Test_DeepScanSlice(t *testing.T) {
+
+	doc := []byte(`{"items":[1,2,3],"a":{"items":[4]},"b":[{"items":[]},{"items":[5,6,7,8]}],"c":{"items":"str"}}`)
+
+	tests := []queryTest{
+		{`$..items[0:2]`, `[1,2,4,5,6]`},
+		{`$..items[0]`, `[1,4,5]`},
+		{`$..items[-1]`, `[3,4,8]`},
+		{`$..items[1:]`, `[2,3,6,7,8]`},
+		{`$..items[-2:]`, `[2,3,4,7,8]`},
+		{`$..items[5:9]`, `[]`},
+		// a slice of a single array still fails when out of range
+		{`$.a.items[0:2]`, `specified array element not found`},
+	}
+	checkQueries(t, doc, nil, tests)
+
+	for _, tst := range tests {
+		res, _ := Get(doc, tst.Query)
+		if size, err := GetSize(doc, tst.Query); err == nil && size != len(res) {
+			t.Errorf(tst.Query+" : size %d, expected %d", size, len(res))
+		}
+	}
+}
+
+func Test_DeepWildcard(t *testing.T) {
+
+	nested := []byte(`{"name":"root","a":{"name":"A","b":{"name":"B"}},"list":[{"name":"L0"},{"x":{"name":"X"}}],"s":"name"}`)
+
+	checkQueries(t, nested, nil, []queryTest{
+		// ..name matches the key itself, the root object included
+		{`$..name`, `["root","A","B","L0","X"]`},
+		// ..*.name takes name of every value below the root
+		{`$..*.name`, `["A","B","L0","X"]`},
+		{`$.a..*.name`, `["B"]`},
+		{`$.list..*.name`, `["L0","X"]`},
+		{`$..*[0].name`, `["L0"]`},
+		{`$..*[?(@.name)].name`, `["L0"]`},
+		{`$..*.missing`, `[]`},
+	})
+
+	spans, err := GetSpans(nested, `$..*.name`)
+	if err != nil || len(spans) != 4 || string(nested[spans[0][0]:spans[0][1]]) != `"A"` {
+		t.Errorf("GetSpans : unexpected %v (%v)", spans, err)
+	}
+}
+
+func Test_MaxScanDepth(t *testing.T) {
+
+	deep := []byte(`{"key":1,"a":{"b":{"key":3,"c":{"d":{"key":5}}}}}`)
+
+	tests := []struct {
+		Depth    int
+		Query    string
+		Expected string
+	}{
+		{0, `$..key`, `[1,3,5]`},
+		{1, `$..key`, `[1]`},
+		{3, `$..key`, `[1,3]`},
+		{5, `$..key`, `[1,3,5]`},
+		{1, `$.a..key`, `[]`},
+		{2, `$.a..key`, `[3]`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions(deep, tst.Query, &Options{MaxScanDepth: tst.Depth})
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + " (depth " + strconv.Itoa(tst.Depth) + ")\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_MaxBytesScanned(t *testing.T) {
+
+	// {"head":{"id":1},"items":[{"id":0,"sub":{"x":{"y":0}}},...]}
+	doc := []byte(`{"head":{"id":1},"items":[`)
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			doc = append(doc, ',')
+		}
+		doc = append(doc, `{"id":`+strconv.Itoa(i)+`,"sub":{"x":{"y":`+strconv.Itoa(i)+`}}}`...)
+	}
+	doc = append(doc, `]}`...)
+
+	limit := 4 * len(doc)
+	tests := []struct {
+		Query string
+		Limit bool
+	}{
+		// narrow queries stop early
+		{`$.head.id`, false},
+		{`$.items[0].sub`, false},
+		{`$.items[-1].id`, false},
+		{`$.items[?(@.id == 5)].sub.x.y`, false},
+		{`$.items[*].*.*.y`, false},
+		// deep scans scan the nested values again at every level
+		{`$..y`, true},
+		{`$..[?(@.y > 500)]`, true},
+	}
+
+	for _, tst := range tests {
+		expected, err := Get(doc, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query+" : %v", err)
+			continue
+		}
+		res, err := GetWithOptions(doc, tst.Query, &Options{MaxBytesScanned: limit})
+		if tst.Limit {
+			if err != errScanLimit {
+				t.Errorf(tst.Query+" : expected %v, got %v", errScanLimit, err)
+			}
+		} else if err != nil || string(res) != string(expected) {
+			t.Errorf(tst.Query+" : unexpected error %v", err)
+		}
+	}
+
+	// every scan counts
+	if _, err := GetWithOptions(doc, `$.items[-1].id`, &Options{MaxBytesScanned: len(doc) / 2}); err != errScanLimit {
+		t.Errorf("$.items[-1].id : expected %v, got %v", errScanLimit, err)
+	}
+}
+
+func Test_WithParents(t *testing.T) {
+
+	nested := []byte(`{"price":0,"items":[{"price":1},[{"price":2}]],"c":{"price":3}}`)
+	opts := &Options{WithParents: true}
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected string
+	}{
+		{data, `$..price`, `[{"parent":0,"value":8.95},{"parent":1,"value":12.99},{"parent":2,"value":8.99},{"parent":3,"value":22.99},{"parent":"bicycle","value":19.95}]`},
+		{data, `$.store.book..author`, `[{"parent":0,"value":"Nigel Rees"},{"parent":1,"value":"Evelyn Waugh"},{"parent":2,"value":"Herman Melville"},{"parent":3,"value":"J. R. R. Tolkien"}]`},
+		{nested, `$..price`, `[{"parent":null,"value":0},{"parent":0,"value":1},{"parent":0,"value":2},{"parent":"c","value":3}]`},
+		{nested, `$..missing`, `[]`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions(tst.Data, tst.Query, opts)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_SortResults(t *testing.T) {
+
+	// equivalent documents, keys in a different order
+	inputs := []string{
+		`{"a":{"x":3,"y":{"x":"b"}},"b":[{"x":1},{"x":{"k":2}}],"c":{"x":"a"}}`,
+		`{"c":{"x":"a"},"b":[{"x":1},{"x":{ "k": 2 }}],"a":{"y":{"x":"b"},"x":3}}`,
+	}
+	tests := []queryTest{
+		{`$..x`, `["a","b",1,3,{"k":2}]`},
+		{`$.*.x`, `["a",3]`},
+		{`$.b[*].x`, `[1,{"k":2}]`},
+		// not an aggregate
+		{`$.a.x`, `3`},
+	}
+
+	opts := &Options{SortResults: true}
+	for _, tst := range tests {
+		for n, input := range inputs {
+			res, err := GetWithOptions([]byte(input), tst.Query, opts)
+			// the elements are emitted as is, so the whitespace may differ
+			if err != nil || string(compactValue(res)) != tst.Expected {
+				t.Errorf("%s : input %d\n\texpected `%s`\n\tbut got  `%s` (%v)", tst.Query, n, tst.Expected, res, err)
+			}
+		}
+	}
+
+	// objects of several keys are ordered by their sorted keys, whatever order they come in
+	for _, input := range []string{`[{"b":1,"a":2},{"a":3}]`, `[{"a":3},{"a":2,"b":1}]`} {
+		res, err := GetWithOptions([]byte(input), `$[*]`, opts)
+		first, _ := Get(res, `$[0].a`)
+		if err != nil || string(first) != `2` {
+			t.Errorf("%s : unexpected order `%s` (%v)", input, res, err)
+		}
+	}
+}
+
+func Test_KeyListAsObject(t *testing.T) {
+
+	doc := []byte(`{"a":1,"b":{"c":[1,2]},"d":"x","e":null,"f":[{"a":1,"b":2},{"b":3}]}`)
+
+	checkQueries(t, doc, &Options{KeyListAsObject: true}, []queryTest{
+		{`$['a','b']`, `{"a":1,"b":{"c":[1,2]}}`},
+		{`$['d','a']`, `{"d":"x","a":1}`},
+		{`$['e']`, `{"e":null}`},
+		{`$['e','d']`, `{"e":null,"d":"x"}`},
+		// a dotted key is not a key list
+		{`$.e`, `null`},
+		// the keys are those of the document
+		{`$['A']`, `{"a":1}`},
+		{`$['D','A']`, `{"d":"x","a":1}`},
+		{`$['X']`, `{}`},
+		// missing keys are omitted
+		{`$['a','x','d']`, `{"a":1,"d":"x"}`},
+		{`$['x','y']`, `{}`},
+		{`$.b['c','x']`, `{"c":[1,2]}`},
+		{`$.f[*]['a','b']`, `[{"a":1,"b":2},{"b":3}]`},
+		{`$.f[*]['b']`, `[{"b":2},{"b":3}]`},
+		{`$.f.*['a','b']`, `[{"a":1,"b":2},{"b":3}]`},
+		{`$.*['a','c']`, `[{"c":[1,2]}]`},
+		{`$..['c','d']`, `[{"d":"x"},{"c":[1,2]},{},{}]`},
+		// not a terminal key list
+		{`$['a','d'][1]`, `"x"`},
+	})
+}
+
+func Test_RecoverPartial(t *testing.T) {
+
+	full := `{"logs":[{"msg":"a","lvl":1},{"msg":"b","lvl":2},{"msg":"c","lvl":3},{"msg":"d","lvl":4}]}`
+	truncated := []byte(full[:len(`{"logs":[{"msg":"a","lvl":1},{"msg":"b","lvl":2},{"msg":"c"`)])
+	opts := &Options{RecoverPartial: true}
+
+	tests := []struct {
+		Data     []byte
+		Query    string
+		Expected string
+		Err      error
+	}{
+		{truncated, `$..msg`, `["a","b","c"]`, ErrPartialResult},
+		{truncated, `$.logs..lvl`, `[1,2]`, ErrPartialResult},
+		{truncated, `$.logs.*.msg`, `["a","b"]`, ErrPartialResult},
+		{truncated, `$.logs.*`, `[{"msg":"a","lvl":1},{"msg":"b","lvl":2}]`, ErrPartialResult},
+		{truncated, `$..missing`, `[]`, ErrPartialResult},
+		{[]byte(full[:len(full)-1]), `$..msg`, `["a","b","c","d"]`, ErrPartialResult},
+		// a well-formed document is not affected
+		{[]byte(full), `$..msg`, `["a","b","c","d"]`, nil},
+		{[]byte(full), `$.logs.*.lvl`, `[1,2,3,4]`, nil},
+	}
+
+	for _, tst := range tests {
+		res, err := GetWithOptions(tst.Data, tst.Query, opts)
+		if !errors.Is(err, tst.Err) || string(res) != tst.Expected {
+			t.Errorf(tst.Query+"\n\texpected `"+tst.Expected+"` (%v)\n\tbut got  `"+string(res)+"` (%v)", tst.Err, err)
+		}
+	}
+
+	// the malformed data error is wrapped
+	if _, err := GetWithOptions(truncated, `$..msg`, opts); err == nil || err.Error() != ErrPartialResult.Error()+": "+errUnexpectedEnd.Error() {
+		t.Errorf("$..msg : unexpected error %v", err)
+	}
+	// without the option the error is returned as before
+	if _, err := Get(truncated, `$..msg`); err == nil || errors.Is(err, ErrPartialResult) {
+		t.Errorf("$..msg : unexpected error %v", err)
+	}
+	// the scan limit is not recovered
+	if _, err := GetWithOptions(truncated, `$..msg`, &Options{RecoverPartial: true, MaxBytesScanned: 10}); err != errScanLimit {
+		t.Errorf("$..msg : expected %v, got %v", errScanLimit, err)
+	}
+}
+
+func Test_GetArrayFilterFunc(t *testing.T) {
+
+	cheap := func(element []byte) (bool, error) {
+		price, err := Get(element, "$.price")
+		if err != nil {
+			return false, nil // no price
+		}
+		f, err := strconv.ParseFloat(string(price), 64)
+		return f < 10, err
+	}
+
+	res, err := GetArrayFilterFunc(data, "$.store.book", cheap)
+	expected := `[{
+						"category": "reference",
+						"author": "Nigel Rees",
+						"title": "Sayings of the Century",
+						"price": 8.95
+					},{
+						"category": "fiction",
+						"author": "Herman Melville",
+						"title": "Moby Dick",
+						"isbn": "0-553-21311-3",
+						"price": 8.99
+					}]`
+	if err != nil || string(res) != expected {
+		t.Errorf("GetArrayFilterFunc : unexpected `%s` (%v)", res, err)
+	}
+
+	res, err = GetArrayFilterFunc([]byte(`{"a":[]}`), "$.a", cheap)
+	if err != nil || string(res) != `[]` {
+		t.Errorf("GetArrayFilterFunc : unexpected `%s` (%v)", res, err)
+	}
+	// predicate error stops the scan
+	_, err = GetArrayFilterFunc([]byte(`[{"price":1},{"price":"x"}]`), "$", cheap)
+	if err == nil {
+		t.Errorf("GetArrayFilterFunc : predicate error expected")
+	}
+	// not an array
+	if _, err = GetArrayFilterFunc(data, "$.store.bicycle", cheap); err != errArrayExpected {
+		t.Errorf("GetArrayFilterFunc : array expected, got %v", err)
+	}
+}
+
+func Test_GetEscaped(t *testing.T) {
+
+	input := []byte(`{"obj": {"a": 1, "s": "x\"y"}, "str": "say \"hi\"", "num": 5, "text": "a\\b"}`)
+
+	tests := []struct {
+		Query    string
+		Expected string
+	}{
+		{`$.obj`, `"{\"a\": 1, \"s\": \"x\\\"y\"}"`},
+		{`$.str`, `"\"say \\\"hi\\\"\""`},
+		{`$.num`, `"5"`},
+		{`$.text`, `"\"a\\\\b\""`},
+		{`$.missing`, `specified array element not found`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetEscaped(input, tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
 		}
-		str = string(b[:n])
-		Get([]byte(str), "$.some.value")
 	}
-	fmt.Println()
-}
 
-func Test_10Mb(t *testing.T) {
-	largeData := GenerateLargeData()
-	expected := []byte(`"Sword of Honour"`)
-	path := "$.store.book[100000].title"
-	res, err := Get(largeData, path)
-	if compareSlices(res, expected) != 0 && err == nil {
-		t.Errorf(path + "\nexpected:\n" + string(expected) + "\ngot:\n" + string(res))
+	// the escaped value decodes back to the original one
+	res, _ := GetEscaped(data, `$.store.book[0]`)
+	var decoded string
+	if err := json.Unmarshal(res, &decoded); err != nil {
+		t.Errorf("GetEscaped : " + err.Error())
+	} else if value, _ := Get(data, `$.store.book[0]`); decoded != string(value) {
+		t.Errorf("GetEscaped : decoded `%s` differs from `%s`", decoded, value)
 	}
 }
 
-func Test_Expressions(t *testing.T) {
+func Test_EscapedBackslash(t *testing.T) {
+
+	// strings ending with an escaped backslash, on their own and within nested values
+	input := []byte(`{"a":"x\\","b":["y\\"],"c":{"d":"z\\\""},"e":1}`)
 
 	tests := []struct {
 		Query    string
-		Expected []byte
+		Expected string
 	}{
-		// self
-		{`$`, data},
-		// simple query
-		{`$.expensive`, []byte(`10`)},
-		// simple query
-		{`$.store.book[3].author`, []byte(`"J. R. R. Tolkien"`)},
+		{`$.a`, `"x\\"`},
+		{`$.b`, `["y\\"]`},
+		{`$.c.d`, `"z\\\""`},
+		{`$.e`, `1`},
+		{`$..e`, `[1]`},
+	}
 
-		// boolean, null
-		{`$.store.open`, []byte(`true`)},
-		{`$.store.branch`, []byte(`null`)},
+	for _, tst := range tests {
+		res, err := Get(input, tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
 
-		// negative index
-		{`$.store.book[-1].author`, []byte(`"J. R. R. Tolkien"`)},
-		// negative indexes
-		{`$.store.book[-3:-2].author`, []byte(`["Evelyn Waugh"]`)},
+func Test_GetConcat(t *testing.T) {
 
-		// functions
-		{`$.store.book.length()`, []byte(`4`)},
-		{`$.store.book.count()`, []byte(`4`)},
-		{`$.store.book.size()`, []byte(`604`)},
+	doc := []byte(`{"doc":{"text":"Hello, ","parts":[{"text":"wor"},{"text":"ld!"},{"x":1}],"end":{"text":" \"bye\"\n"}},"n":[1],"e":""}`)
 
-		// aggregated
-		{`$.store.book[1:3].author`, []byte(`["Evelyn Waugh","Herman Melville"]`)},
-		// aggregated, skip missing keys
-		{`$.store.book[1:].isbn`, []byte(`["0-553-21311-3","0-395-19395-8"]`)},
-		// aggregated, enumerate indexes
-		{`$.store.book[0,2].title`, []byte(`["Sayings of the Century","Moby Dick"]`)},
+	tests := []struct {
+		Query    string
+		Expected string
+	}{
+		{`$..text`, `"Hello, world! \"bye\"\n"`},
+		{`$.doc.parts[*].text`, `"world!"`},
+		{`$.doc.parts[?(@.text)].text`, `"world!"`},
+		{`$.doc.text`, `"Hello, "`},
+		{`$.e`, `""`},
+		{`$..missing`, `""`},
+		// not strings
+		{`$.doc.parts`, `string expected`},
+		{`$..x`, `string expected`},
+		{`$.n[*]`, `string expected`},
+	}
 
-		// filters: simple expression
-		{`$.store.book[?(@.price>10)].title`, []byte(`["Sword of Honour","The Lord of the Rings"]`)},
-		// filters: simple expression + spaces
-		{`$.store.book[?(@.price < 10)].title`, []byte(`["Sayings of the Century","Moby Dick"]`)},
-		// filters: simple expression
-		{`$.store.book[?(@.price==12.99)].title`, []byte(`["Sword of Honour"]`)},
-		// more spaces
-		{`$.store.book[?(   @.price   >   10)].title`, []byte(`["Sword of Honour","The Lord of the Rings"]`)},
-		// field presence
-		{`$.store.book[?(@.isbn)].title`, []byte(`["Moby Dick","The Lord of the Rings"]`)},
-		// string match
-		{`$.store.book[?(@.isbn == "0-553-21311-3")].title`, []byte(`["Moby Dick"]`)},
-		// string mismatch
-		{`$.store.book[?(@.isbn != "0-553-21311-3")].title`, []byte(`["The Lord of the Rings"]`)},
-		// root references
-		{`$.store.book[?(@.price > $.expensive)].title`, []byte(`["Sword of Honour","The Lord of the Rings"]`)},
-		// math +
-		{`$.store.book[?(@.price > $.expensive+1)].price`, []byte(`[12.99,22.99]`)},
-		// math -
-		{`$.store.book[?(@.price > $.expensive-1)].price`, []byte(`[12.99,22.99]`)},
-		// math *
-		{`$.store.book[?(@.price > $.expensive*1.1)].price`, []byte(`[12.99,22.99]`)},
-		// math /
-		{`$.store.book[?(@.price > $.expensive/0.7)].price`, []byte(`[22.99]`)},
-		// logic operators : AND
-		{`$.store.book[?(@.price > $.expensive && @.isbn)].title`, []byte(`["The Lord of the Rings"]`)},
-		// logic operators : OR
-		{`$.store.book[?(@.price >= $.expensive || @.isbn)].title`, []byte(`["Moby Dick","The Lord of the Rings"]`)},
-		// logic operators : AND/OR numbers, strings
-		{`$.store.book[?(@.price || @.isbn != "")].title`, []byte(`["Sayings of the Century","Sword of Honour","Moby Dick","The Lord of the Rings"]`)},
-		// logic operators : same as above, for coverage's sake
-		{`$.store.book[?(@.isbn != "" || @.price)].title`, []byte(`["Sayings of the Century","Sword of Honour","Moby Dick","The Lord of the Rings"]`)},
-		// non-empty field
-		{`$.store.book[?(@.price)].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
-		// bool ==
-		{`$.store.book[?($.store.open == true)].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
-		// bool !=
-		{`$.store.book[?($.store.open != false)].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
-		// bool <
-		{`$.store.book[?($.store.open > false)].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
-		// bool >
-		{`$.store.book[?($.store.open < true)].price`, []byte(``)},
-		// escaped chars
-		{`$.store.bicycle.equipment[?(@[0] == "\"quoted\"")]`, []byte(`[["\"quoted\""]]`)},
-		// numbers
-		{`$.store.book[?(20 <= @.price)].title`, []byte(`["The Lord of the Rings"]`)},
-		// numbers (+)
-		{`$.store.book[?(@.price != 22.99)].price`, []byte(`[8.95,12.99,8.99]`)},
+	for _, tst := range tests {
+		res, err := GetConcat(doc, tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
 
-		// regexp
-		{`$.store.book[?(@.title =~ /the/i)].title`, []byte(`["Sayings of the Century","The Lord of the Rings"]`)},
-		// regexp
-		{`$.store.book[?(@.title =~ /(Saying)|(Lord)/)].title`, []byte(`["Sayings of the Century","The Lord of the Rings"]`)},
+func Test_GetManyMap(t *testing.T) {
 
-		// array of arrays
-		{`$.store.bicycle.equipment[1][0]`, []byte(`"peg leg"`)},
-		// filter expression not found -- not an error
-		{`$.store.book[?($.store[0] > 0)]`, []byte(`[]`)},
-		// wildcard: any key within an object
-		{`$.store.book[0].*`, []byte(`["reference","Nigel Rees","Sayings of the Century",8.95]`)},
-		// wildcard: named key on a given level
-		{`$.store.*.price`, []byte(`[19.95]`)},
-		// wildcard: named key in any array on a given level
-		{`$.store.*[:].price`, []byte(`[8.95,12.99,8.99,22.99]`)},
+	res, err := GetManyMap(data, map[string]string{
+		"first":   "$.store.book[0].title",
+		"prices":  "$.store.book[:2].price",
+		"color":   "$.store.bicycle.color",
+		"missing": "$.store.bicycle.brand",
+	})
+	expected := `{"color":"red","first":"Sayings of the Century","missing":null,"prices":[8.95,12.99]}`
+	if err != nil || string(res) != expected {
+		t.Errorf("GetManyMap\n\texpected `%s`\n\tbut got  `%s` (%v)", expected, res, err)
+	}
 
-		// all elements of an empty array is an empty array
-		{`$.store.manager[:]`, []byte(`[]`)},
+	res, err = GetManyMap(data, map[string]string{"a\"b\n": "$.expensive"})
+	if err != nil || string(res) != `{"a\"b\n":10}` {
+		t.Errorf("GetManyMap : unexpected `%s` (%v)", res, err)
+	}
+	res, err = GetManyMap(data, nil)
+	if err != nil || string(res) != `{}` {
+		t.Errorf("GetManyMap : unexpected `%s` (%v)", res, err)
+	}
+	// errors other than "not found" are returned
+	if _, err = GetManyMap(data, map[string]string{"x": "store"}); err != errPathRootExpected {
+		t.Errorf("GetManyMap : $ expected, got %v", err)
+	}
+}
 
-		// multiple keys (ordered as in query)
-		{`$.store.book[:]['price','title']`, []byte(`[[8.95,"Sayings of the Century"],[12.99,"Sword of Honour"],[8.99,"Moby Dick"],[22.99,"The Lord of the Rings"]]`)},
-		// multiple keys combined with filter
-		{`$.store.book[?(@.price > $.expensive*1.1)]['price','title']`, []byte(`[[12.99,"Sword of Honour"],[22.99,"The Lord of the Rings"]]`)},
+func Test_GlobKeys(t *testing.T) {
 
-		// functions in filter
-		{`$.store.bicycle.equipment[?(@.count() == 2)][1]`, []byte(`["apparel"]`)},
+	input := []byte(`{"data": {"user_name": "bob", "user_id": 7, "group_id": 3, "ab": 1, "axxb": 2, "abc": 3,
+		"user_tags": ["a", "b"], "User_Role": {"id": 5}}}`)
+
+	tests := []struct {
+		Query    string
+		Expected string
+	}{
+		{`$.data.user_*`, `["bob",7,["a", "b"],{"id": 5}]`},
+		{`$.data.*_id`, `[7,3]`},
+		{`$.data.a*b`, `[1,2]`},
+		{`$.data.*_*`, `["bob",7,3,["a", "b"],{"id": 5}]`},
+		{`$.data.user_*.id`, `[5]`},
+		{`$.data.user_*[1]`, `["b"]`},
+		{`$.data.none_*`, `[]`},
+		// standalone wildcard is still a wildcard
+		{`$.data.*.id`, `[5]`},
+		// glob keys are path-only, '*' is a multiplication in filters
+		{`$.data[?(@.user_id*2 == 14)]`, `array expected`},
 	}
 
 	for _, tst := range tests {
-		res, err := Get(data, tst.Query)
+		res, err := Get(input, tst.Query)
 		if err != nil {
-			t.Errorf(tst.Query + " : " + err.Error())
-		} else if compareSlices(res, tst.Expected) != 0 {
-			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+			res = []byte(err.Error())
 		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+
+	spans, err := GetSpans(input, `$.data.*_id`)
+	if err != nil || len(spans) != 2 || string(input[spans[1][0]:spans[1][1]]) != "3" {
+		t.Errorf("GetSpans : unexpected %v (%v)", spans, err)
 	}
 }
 
-func Test_Fixes(t *testing.T) {
+func Test_LiteralAsterisk(t *testing.T) {
+
+	doc := []byte(`{"*":{"a":1},"b":{"a":2},"x":{"*":3,"y":4}}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.*`, `[{"a":1},{"a":2},{"*":3,"y":4}]`},
+		{`$['*']`, `{"a":1}`},
+		{`$['*'].a`, `1`},
+		{`$.*.a`, `[1,2]`},
+		{`$.x['*']`, `3`},
+		{`$.x.*`, `[3,4]`},
+		{`$['*','b']`, `[{"a":1},{"a":2}]`},
+		{`$..['*']`, `[{"a":1},3]`},
+	})
+
+	spans, err := GetSpans(doc, `$.x['*']`)
+	if err != nil || len(spans) != 1 || string(doc[spans[0][0]:spans[0][1]]) != "3" {
+		t.Errorf("GetSpans : unexpected %v (%v)", spans, err)
+	}
+}
+
+func Test_NestedWildcards(t *testing.T) {
+
+	doc := []byte(`{"x":{"p":{"id":1},"q":{"id":2,"items":[{"id":5},{"id":6}]}},"y":{"r":{"id":3},"s":[{"id":4}]},"z":7}`)
 
 	tests := []struct {
-		Data     []byte
 		Query    string
-		Expected []byte
+		Expected string
 	}{
-		// closing square bracket inside a string value has been mistakenly taken as an array bound
-		{[]byte(`{"foo":["[]"],"bar":123}`), `$.bar`, []byte(`123`)},
+		{`$.*.*`, `[{"id":1},{"id":2,"items":[{"id":5},{"id":6}]},{"id":3},[{"id":4}]]`},
+		{`$.*.*.id`, `[1,2,3]`},
+		{`$.*.*.items[*].id`, `[5,6]`},
+		{`$.*.*.items[:].id`, `[5,6]`},
+		{`$.x.*.items[*].id`, `[5,6]`},
+		{`$.*.*[0].id`, `[4]`},
+		{`$.*.*.*`, `[1,2,[{"id":5},{"id":6}],3,{"id":4}]`},
+		{`$.*.*.missing`, `[]`},
+		{`$.x.q.items[*]`, `[{"id":5},{"id":6}]`},
 	}
 
 	for _, tst := range tests {
-		res, err := Get(tst.Data, tst.Query)
+		res, err := Get(doc, tst.Query)
 		if err != nil {
-			t.Errorf(tst.Query + " : " + err.Error())
-		} else if compareSlices(res, tst.Expected) != 0 {
-			t.Errorf(tst.Query + "\n\texpected `" + string(tst.Expected) + "`\n\tbut got  `" + string(res) + "`")
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+		spans, err := GetSpans(doc, tst.Query)
+		if err != nil {
+			t.Errorf(tst.Query + " : GetSpans " + err.Error())
+			continue
+		}
+		elems := make([][]byte, len(spans))
+		for i, span := range spans {
+			elems[i] = doc[span[0]:span[1]]
 		}
+		if string(mergeElements(elems)) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected spans of `" + tst.Expected + "`\n\tbut got  `" + string(mergeElements(elems)) + "`")
+		}
+	}
+}
+
+func Test_KeyListIndex(t *testing.T) {
+
+	doc := []byte(`{"a":{"x":1},"b":[1,2,3],"c":"s","o":{"a":1,"b":2}}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$['a','b'][0]`, `{"x":1}`},
+		{`$['a','b'][-1]`, `[1,2,3]`},
+		{`$['a','b'][0].x`, `1`},
+		{`$['b','a'][0][1]`, `2`},
+		{`$['a','b','c'][1:]`, `[[1,2,3],"s"]`},
+		{`$['a','b'][?(@.x)]`, `[{"x":1}]`},
+		{`$['a','missing','c'][-1]`, `"s"`},
+		{`$.o['a','b'][1]`, `2`},
+		{`$['b'][1]`, `2`},
+		// key list values are not objects
+		{`$['a','b'].x`, `object expected`},
+	})
+
+	spans, err := GetSpans(doc, `$['a','b'][-1]`)
+	if err != nil || len(spans) != 1 || string(doc[spans[0][0]:spans[0][1]]) != `[1,2,3]` {
+		t.Errorf("GetSpans : unexpected %v (%v)", spans, err)
+	}
+}
+
+func Test_GetInto(t *testing.T) {
+
+	dst := make([]byte, 64)
+
+	n, err := GetInto(dst, data, "$.store.book[3].title")
+	if err != nil || string(dst[:n]) != `"The Lord of the Rings"` {
+		t.Errorf("GetInto : unexpected `%s` (%v)", dst[:n], err)
+	}
+	// aggregated result
+	n, err = GetInto(dst, data, "$.store.book[1:3].price")
+	if err != nil || string(dst[:n]) != `[12.99,8.99]` {
+		t.Errorf("GetInto : unexpected `%s` (%v)", dst[:n], err)
+	}
+	// buffer too small: required size returned, nothing written
+	small := []byte("xxxxx")
+	n, err = GetInto(small, data, "$.store.book[3].title")
+	if err != ErrBufferTooSmall || n != len(`"The Lord of the Rings"`) || string(small) != "xxxxx" {
+		t.Errorf("GetInto : buffer too small expected, got %d (%v)", n, err)
+	}
+	// errors
+	if _, err = GetInto(dst, data, "$.store.book[99]"); err != ErrArrayElementNotFound {
+		t.Errorf("GetInto : not found expected, got %v", err)
+	}
+	if _, err = GetInto(dst, data, "store"); err != errPathRootExpected {
+		t.Errorf("GetInto : $ expected, got %v", err)
+	}
+	// no allocations in the simple case, the race detector allocates on its own
+	if raceEnabled {
+		return
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		GetInto(dst, data, "$.store.book[3].title")
+	})
+	if allocs > 0 {
+		t.Errorf("GetInto : %v allocations per run, 0 expected", allocs)
 	}
 }
 
@@ -336,15 +2028,37 @@ func Test_Errors(t *testing.T) {
 		{data, ``, `path: empty`},
 		// unexpected end
 		{data, `$.`, `path: unexpected end of path at 2`},
+		{data, `$.store.`, `path: unexpected end of path at 8`},
+		{data, `$.store.book[0].`, `path: unexpected end of path at 16`},
+		// deep scan without a target
+		{data, `$..`, `path: deep scan target expected at 3`},
+		{data, `$.store..`, `path: deep scan target expected at 9`},
+		{data, `$...price`, `path: deep scan target expected at 3`},
 		// bad function
 		{data, `$.foo()`, `path: unknown function at 5`},
 
+		// key list: unterminated or malformed
+		{data, `$['a'`, `path: key list terminated unexpectedly at 5`},
+		{data, `$['a',`, `path: key list terminated unexpectedly at 6`},
+		{data, `$['a', `, `path: key list terminated unexpectedly at 6`},
+		{data, `$['a`, `path: key list terminated unexpectedly at 4`},
+		{data, `$['a','b`, `path: key list terminated unexpectedly at 8`},
+		{data, `$['a''b']`, `path: ',' or ']' expected in key list at 5`},
+		{data, `$['a' x]`, `path: ',' or ']' expected in key list at 6`},
+		{data, `$['a',]`, `path: quoted key expected in key list at 6`},
+		{data, `$['a',b]`, `path: quoted key expected in key list at 6`},
+
 		// array: index bound missing
 		{data, `$.store.book[1`, `path: index bound missing at 14`},
 		// array: path: 0 as a second bound does not make sense
 		{data, `$.store.book[1:0`, `path: 0 as a second bound does not make sense at 15`},
 		// array: index bound missing (2nd)
 		{data, `$.store.book[1:3`, `path: index bound missing at 16`},
+		// array: index exceeds int range
+		{data, `$.store.book[99999999999999999999]`, `path: index out of range at 13`},
+		{data, `$.store.book[-99999999999999999999]`, `path: index out of range at 13`},
+		{data, `$.store.book[1:99999999999999999999]`, `path: index out of range at 15`},
+		{data, `$.store.book[0,99999999999999999999]`, `path: index out of range at 15`},
 		// array: node does not exist
 		{data, `$.store.book[99]`, `specified array element not found`},
 		// array: node does not exist
@@ -353,9 +2067,10 @@ func Test_Errors(t *testing.T) {
 		{data, `$.store.book[-99:-15]`, `specified array element not found`},
 
 		// filter expression: empty
-		{data, `$.store.book[?()]`, `empty filter`},
+		{data, `$.store.book[?()]`, `empty filter at 15`},
 		// filter expression: invalid
-		{data, `$.store.book[?(1+)]`, `not enough arguments`},
+		{data, `$.store.book[?(1+)]`, `not enough arguments at 17`},
+		{data, `$.store.book[?(@.price 10)]`, `operator expected at 25`},
 
 		// wrong bool value
 		{[]byte(`{"foo": Troo}`), `$.foo`, `unrecognized value: true, false or null expected`},
@@ -368,6 +2083,14 @@ func Test_Errors(t *testing.T) {
 		// unexpected EOF
 		{[]byte(`{"foo": {"bar":"moo`), `$.foo.moo`, `unexpected end of input`},
 
+		// complete object, key is absent
+		{[]byte(`{"foo": 1, "bar": {"baz": 2} }`), `$.baz`, `specified array element not found`},
+		{[]byte(`{ }`), `$.foo`, `specified array element not found`},
+		// truncated object, key is absent
+		{[]byte(`{"foo": 1`), `$.bar`, `unexpected end of input`},
+		{[]byte(`{"foo": 1, "ba`), `$.bar`, `unexpected end of input`},
+		{[]byte(`{"foo": 1,  `), `$.bar`, `unexpected end of input`},
+
 		// invalid json
 		{[]byte(`{"foo" - { "bar": 0 }}`), `$.foo.bar`, `':' expected`},
 
@@ -375,6 +2098,27 @@ func Test_Errors(t *testing.T) {
 		{[]byte(`{"foo":[{"bar":"moo"}]}`), `$.foo[?(@.bar > "zzz")]`, `operator is not applicable to strings`},
 		// unknown token
 		{[]byte(`{"foo":[{"bar":"moo"}]}`), `$.foo[?(@.bar == 2^3)]`, `unknown token at 18`},
+		// function arguments
+		{data, `$.store.book.nth()`, `path: invalid function argument at 17`},
+		{data, `$.store.book.nth(x)`, `path: invalid function argument at 17`},
+		{data, `$.store.book.length(1)`, `path: invalid function argument at 20`},
+		{data, `$.store.book.nth(9)`, `specified array element not found`},
+		{data, `$.store.book.nth(-9)`, `specified array element not found`},
+		{data, `$.store.bicycle.nth(0)`, `array expected`},
+		// unbalanced filter parentheses
+		{data, `$.store.book[?(@.price == 1]`, `')' expected in filter at 27`},
+		{data, `$.store.book[?(@.price`, `')' expected in filter at 22`},
+		{data, `$.store.book[?(@.price == 1)`, `path: index bound missing at 28`},
+		{data, `$.store.book[?(@.price == 1))]`, `path: index bound missing at 28`},
+		{data, `$.store.book[?( )]`, `empty filter at 16`},
+		// grouping parentheses are not supported, function calls are
+		{data, `$.store.book[?((@.price) > 1)]`, `unknown token at 15`},
+		{data, `$.store.book[?(@.title.length() > 1 && type(@.isbn) == 'string']`, `')' expected in filter at 63`},
+		// invalid null
+		{[]byte(`{"foo":[{"bar":"moo"}]}`), `$.foo[?(@.bar == nul)]`, `invalid null value at 17`},
+		// whitespace-only path; error positions refer to the padded path
+		{data, `   `, `path: empty`},
+		{data, `  $.store(foo  `, `path: invalid element reference at 9`},
 	}
 
 	for _, tst := range tests {
@@ -387,6 +2131,79 @@ func Test_Errors(t *testing.T) {
 	}
 }
 
+func Test_PathError(t *testing.T) {
+
+	tests := []struct {
+		Path string
+		Err  error
+		Pos  int
+	}{
+		{`$.a[`, errPathIndexBoundMissing, 4},
+		{`  $.a[:0]`, errPathIndexNonsense, 7},
+		{`$.store.book[?(1+)]`, errNotEnoughArguments, 17},
+		{`$.x ?? 1x`, errPathFallbackValue, 7},
+		{`$.x ?? $.b[`, errPathIndexBoundMissing, 11},
+	}
+
+	for _, tst := range tests {
+		_, err := Get([]byte(`{"a":[1]}`), tst.Path)
+		perr, ok := err.(*PathError)
+		if !ok {
+			t.Errorf(tst.Path+" : PathError expected, got %v", err)
+			continue
+		}
+		if perr.Unwrap() != tst.Err || perr.Pos != tst.Pos || perr.Path != tst.Path {
+			t.Errorf(tst.Path+" : unexpected %v at %d of `%s`", perr.Err, perr.Pos, perr.Path)
+		}
+		if expected := tst.Err.Error() + " at " + strconv.Itoa(tst.Pos); err.Error() != expected {
+			t.Errorf(tst.Path + "\n\texpected `" + expected + "`\n\tbut got  `" + err.Error() + "`")
+		}
+	}
+
+	// other errors are not wrapped
+	if _, err := Get([]byte(`{"a":[1]}`), `$.b`); err != ErrArrayElementNotFound {
+		t.Errorf("$.b : unexpected %v", err)
+	}
+	if _, err := Get([]byte(`{"a":[1]}`), `$.x ?? $.a[5]`); !errors.Is(err, ErrArrayElementNotFound) {
+		t.Errorf("$.x ?? $.a[5] : unexpected %v", err)
+	}
+}
+
+func Test_Numbers(t *testing.T) {
+
+	tests := []struct {
+		Input    string
+		Query    string
+		Expected string
+	}{
+		{`{"x":1e+5,"y":2}`, `$.x`, `1e+5`},
+		{`[1e+5,2]`, `$[0]`, `1e+5`},
+		{`[1e+5,2]`, `$[1]`, `2`},
+		{`[{"a":1e+5},{"a":1e-5}]`, `$[?(@.a > 1)].a`, `[1e+5]`},
+		{`{"x":1e+10}`, `$.x`, `1e+10`},
+		{`{"x":1.5E-3}`, `$.x`, `1.5E-3`},
+		{`{"x":-1.5E+3}`, `$.x`, `-1.5E+3`},
+		{`[{"a":1.5E-3},{"a":1.5E+3}]`, `$[?(@.a < 1)].a`, `[1.5E-3]`},
+		// a sign elsewhere ends the number
+		{`{"x":2+3}`, `$.x`, `2`},
+		{`{"x":2-3}`, `$.x`, `2`},
+		// a leading '+' is not json, but Get tolerates it (see Validate)
+		{`{"x": +5, "y":1}`, `$.x`, `+5`},
+		{`{"x": +5, "y":1}`, `$.y`, `1`},
+		{`[{"a":+1},{"a":0}]`, `$[?(@.a > 0)].a`, `[+1]`},
+	}
+
+	for _, tst := range tests {
+		res, err := Get([]byte(tst.Input), tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Input + " " + tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
 func Test_ArraySlice(t *testing.T) {
 
 	tests := []struct {
@@ -479,6 +2296,96 @@ func Test_ArraySlice_Errors(t *testing.T) {
 	}
 }
 
+func Test_IndexLists(t *testing.T) {
+
+	doc := []byte(`[0,1,2,3,4,5,6,7]`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$[0,2]`, `[0,2]`},
+		{`$[0,-1]`, `[0,7]`},
+		{`$[0:2,5:7]`, `[0,1,5,6]`},
+		{`$[0,3:5]`, `[0,3,4]`},
+		{`$[ 0 , 3 : 5 ]`, `[0,3,4]`},
+		{`$[:2,-2:]`, `[0,1,6,7]`},
+		{`$[6:,1]`, `[6,7,1]`},
+		// overlapping members are not deduplicated
+		{`$[0:3,1:2]`, `[0,1,2,1]`},
+		// errors
+		{`$[0,10]`, `specified array element not found`},
+		{`$[0,2:10]`, `specified array element not found`},
+		{`$[1,`, `path: index bound missing at 4`},
+		{`$[1 2]`, `path: index bound missing at 4`},
+		{`$[0,1:0]`, `path: 0 as a second bound does not make sense at 6`},
+	})
+
+	elems, err := GetArrayElements(doc, `$[0,3:5]`, 0)
+	if err != nil || string(mergeElements(elems)) != `[0,3,4]` {
+		t.Errorf("GetArrayElements : unexpected %s (%v)", mergeElements(elems), err)
+	}
+}
+
+func Test_SliceStep(t *testing.T) {
+
+	doc := []byte(`{"items":[0,1,2,3,4,5,6,7,8,9],"objs":[{"n":0},{"n":1},{"n":2},{"n":3}],"a":{"items":[10,11,12]}}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.items[0:10:2]`, `[0,2,4,6,8]`},
+		{`$.items[::2]`, `[0,2,4,6,8]`},
+		{`$.items[1::3]`, `[1,4,7]`},
+		{`$.items[-4::2]`, `[6,8]`},
+		{`$.items[0:5:1]`, `[0,1,2,3,4]`},
+		{`$.items[0:5:]`, `[0,1,2,3,4]`},
+		{`$.items[ 2 : 8 : 4 ]`, `[2,6]`},
+		{`$.items[0:3:5]`, `[0]`},
+		{`$.items[0:2:2,7:]`, `[0,7,8,9]`},
+		{`$.objs[::2].n`, `[0,2]`},
+		{`$..items[::2]`, `[0,2,4,6,8,10,12]`},
+		{`$.items[0:10:0]`, `path: 0 as a slice step does not make sense at 13`},
+		{`$.items[0:20:2]`, `specified array element not found`},
+	})
+
+	elems, err := GetArrayElements(doc, `$.items[1:9:3]`, 0)
+	if err != nil || len(elems) != 3 || string(elems[2]) != "7" {
+		t.Errorf("GetArrayElements : unexpected %q (%v)", elems, err)
+	}
+	spans, err := GetSpans(doc, `$.items[::4]`)
+	if err != nil || len(spans) != 3 || string(doc[spans[1][0]:spans[1][1]]) != "4" {
+		t.Errorf("GetSpans : unexpected %v (%v)", spans, err)
+	}
+	if explained, err := ExplainPath(`$.items[1::2]`); err != nil || explained != `key 'items' → slice [1::2]` {
+		t.Errorf("ExplainPath : unexpected %v (%v)", explained, err)
+	}
+}
+
+func Test_ReverseSlice(t *testing.T) {
+
+	doc := []byte(`{"items":[0,1,2,3,4,5,6],"objs":[{"n":0},{"n":1},{"n":2}],"a":{"items":[7,8]},"empty":[]}`)
+
+	checkQueries(t, doc, nil, []queryTest{
+		{`$.items[::-1]`, `[6,5,4,3,2,1,0]`},
+		{`$.items[5:1:-1]`, `[5,4,3,2]`},
+		{`$.items[::-2]`, `[6,4,2,0]`},
+		{`$.items[0::-1]`, `[0]`},
+		{`$.items[5:0:-1]`, `[5,4,3,2,1]`},
+		{`$.items[-1:-3:-1]`, `[6,5]`},
+		{`$.items[2:5:-1]`, `[]`},
+		{`$.empty[::-1]`, `[]`},
+		{`$.objs[::-1].n`, `[2,1,0]`},
+		{`$..items[::-1]`, `[6,5,4,3,2,1,0,8,7]`},
+		{`$.items[10::-1]`, `specified array element not found`},
+		{`$.items[:0]`, `path: 0 as a second bound does not make sense at 9`},
+	})
+
+	elems, err := GetArrayElements(doc, `$.items[::-3]`, 0)
+	if err != nil || len(elems) != 3 || string(elems[0]) != "6" || string(elems[2]) != "0" {
+		t.Errorf("GetArrayElements : unexpected %q (%v)", elems, err)
+	}
+	spans, err := GetSpans(doc, `$.items[1::-1]`)
+	if err != nil || len(spans) != 2 || string(doc[spans[0][0]:spans[0][1]]) != "1" {
+		t.Errorf("GetSpans : unexpected %v (%v)", spans, err)
+	}
+}
+
 func Benchmark_Unmarshal(b *testing.B) {
 	var jdata interface{}
 	for i := 0; i < b.N; i++ {
@@ -513,7 +2420,7 @@ func Benchmark_JsonSlice_ParsePath(b *testing.B) {
 	nodePool.Put(nodePool.Get())
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		node, _, _ := parsePath(path)
+		node, _, _ := parsePath(path, true)
 		// return nodes back to pool
 		for {
 			if node == nil {
@@ -532,12 +2439,44 @@ func Benchmark_Jsonslice_Get(b *testing.B) {
 	}
 }
 
+func Benchmark_Jsonslice_GetInto(b *testing.B) {
+	dst := make([]byte, 64)
+	for i := 0; i < b.N; i++ {
+		_, _ = GetInto(dst, data, "$.store.book[3].title")
+	}
+}
+
 func Benchmark_Jsonslice_Get_Aggregated(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		_, _ = Get(data, "$.store.book[1:4].isbn")
 	}
 }
 
+func Benchmark_Jsonslice_PreparedPath(b *testing.B) {
+	path, _ := Compile("$.store.book[?(@.price > $.expensive)].title")
+	for i := 0; i < b.N; i++ {
+		_, _ = path.Get(data)
+	}
+}
+
+func Benchmark_Jsonslice_GetMany(b *testing.B) {
+	// 20 fields of a message
+	msg := []byte{'{'}
+	paths := make([]string, 20)
+	for i := range paths {
+		if i > 0 {
+			msg = append(msg, ',')
+		}
+		msg = append(msg, `"field`+strconv.Itoa(i)+`":{"v":"value `+strconv.Itoa(i)+`","n":[1,2,3]}`...)
+		paths[i] = "$.field" + strconv.Itoa(i) + ".v"
+	}
+	msg = append(msg, '}')
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = GetMany(msg, paths)
+	}
+}
+
 func GenerateLargeData() []byte {
 	largeData := []byte(`{"store":{ "book": [`)
 	book0, _ := Get(data, "$.store.book[0]")
@@ -550,6 +2489,7 @@ func GenerateLargeData() []byte {
 	largeData = append(largeData, []byte("]}")...)
 	return largeData
 }
+
 func Benchmark_Unmarshal_10Mb(b *testing.B) {
 	var jdata interface{}
 	b.StopTimer()
@@ -0,0 +1,225 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import (
+	"bytes"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// GetUnique is Get for an aggregating jsonpath (wildcard, filter, slice, key list, deep scan)
+// keeping only the first of the structurally equal elements matched.
+// Values are equal regardless of the object key order, whitespace, string escaping and number notation:
+// {"a":1,"b":"x"} equals { "b": "x", "a": 1.0 }. Any other jsonpath gives the same result as Get.
+// In a ?? fallback chain the elements of the alternative found are deduplicated.
+func GetUnique(input []byte, path string) ([]byte, error) {
+
+	if strings.Contains(path, "??") {
+		if alts := fallbacks(path); len(alts) > 1 {
+			nodes, literal, err := compileFallbacks(path, alts, nil)
+			defer repoolAll(nodes)
+			if err != nil {
+				return nil, err
+			}
+			return fallbackValue(nodes, literal, func(node *tNode) ([]byte, error) {
+				return uniqueValue(input, node)
+			})
+		}
+	}
+
+	node, err := compilePath(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer repool(node)
+
+	return uniqueValue(input, node)
+}
+
+// uniqueValue is the value matching the node chain, the elements of an aggregate deduplicated
+func uniqueValue(input []byte, node *tNode) ([]byte, error) {
+
+	q := newQuery(input)
+
+	result, err := getValue(q, input, node)
+	if err != nil || !aggregates(node) || len(result) == 0 {
+		return result, err
+	}
+	elems, err := arrayValues(result)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(elems))
+	unique := elems[:0]
+	for _, elem := range elems {
+		canon, err := appendCanonicalValue(nil, elem)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[string(canon)] {
+			seen[string(canon)] = true
+			unique = append(unique, elem)
+		}
+	}
+	return mergeElements(unique), nil
+}
+
+// GetChecksum returns the 64-bit FNV-1a hash of the canonical form of the value matching jsonpath,
+// so equal values give the same checksum regardless of the object key order, whitespace, string escaping and number notation.
+func GetChecksum(input []byte, path string) (uint64, error) {
+	canon, err := canonicalResult(input, path)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	h.Write(canon)
+	return h.Sum64(), nil
+}
+
+// Equal reports whether pathA and pathB resolve to structurally equal values (see GetUnique for equality),
+// like $.header.total and $.summary.total being 10 and 1e1.
+func Equal(input []byte, pathA, pathB string) (bool, error) {
+	a, err := canonicalResult(input, pathA)
+	if err != nil {
+		return false, err
+	}
+	b, err := canonicalResult(input, pathB)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(a, b), nil
+}
+
+// canonicalResult returns the canonical form of the value matching jsonpath
+func canonicalResult(input []byte, path string) ([]byte, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return nil, err
+	}
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 {
+		value = []byte("[]") // nothing matched
+	}
+	return appendCanonicalValue(nil, value)
+}
+
+// CountDistinct returns the number of structurally different values of field across the elements of the array matching arrayPath
+// (see GetUnique for equality). The elements lacking field are not counted.
+func CountDistinct(input []byte, arrayPath, field string) (int, error) {
+	column, err := GetColumn(input, arrayPath, field)
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool, len(column))
+	var canon []byte
+	for _, val := range column {
+		if val == nil {
+			continue
+		}
+		if canon, err = appendCanonicalValue(canon[:0], val); err != nil {
+			return 0, err
+		}
+		seen[string(canon)] = true
+	}
+	return len(seen), nil
+}
+
+// GroupBy returns an object mapping each of the distinct values of keyField to the array of the elements of the array
+// matching arrayPath having that value, in the order of the first occurrence: {"paid":[{...},{...}],"new":[{...}]}.
+// The values are compared in the canonical form, values other than strings are turned into strings: 1.0 groups under "1".
+// The elements lacking keyField are left out.
+func GroupBy(input []byte, arrayPath, keyField string) ([]byte, error) {
+	elems, err := arrayElements(input, arrayPath)
+	if err != nil {
+		return nil, err
+	}
+	column, err := fieldValues(elems, keyField)
+	if err != nil {
+		return nil, err
+	}
+	var keys [][]byte
+	groups := make(map[string][][]byte)
+	for i, val := range column {
+		if val == nil {
+			continue
+		}
+		key, err := appendCanonicalValue(nil, val)
+		if err != nil {
+			return nil, err
+		}
+		if key[0] != '"' {
+			key = appendString(nil, string(key))
+		}
+		if _, ok := groups[string(key)]; !ok {
+			keys = append(keys, key)
+		}
+		groups[string(key)] = append(groups[string(key)], elems[i])
+	}
+	result := []byte{'{'}
+	for i, key := range keys {
+		if i > 0 {
+			result = append(result, ',')
+		}
+		result = append(append(result, key...), ':')
+		result = append(result, mergeElements(groups[string(key)])...)
+	}
+	return append(result, '}'), nil
+}
+
+// appendCanonicalValue appends the canonical form of a value: compacted, object keys sorted,
+// strings and numbers in the canonical form
+func appendCanonicalValue(dst []byte, value []byte) ([]byte, error) {
+	switch value[0] {
+	case '{':
+		keys, vals, err := objectMembers(value)
+		if err != nil {
+			return nil, err
+		}
+		members := make([][]byte, len(keys))
+		for i := range keys {
+			member := appendCanonical([]byte{'"'}, keys[i])
+			if members[i], err = appendCanonicalValue(append(member, '"', ':'), vals[i]); err != nil {
+				return nil, err
+			}
+		}
+		sort.Slice(members, func(i, j int) bool { return bytes.Compare(members[i], members[j]) < 0 })
+		dst = append(dst, '{')
+		for i, member := range members {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(dst, member...)
+		}
+		return append(dst, '}'), nil
+	case '[':
+		elems, err := arrayValues(value)
+		if err != nil {
+			return nil, err
+		}
+		dst = append(dst, '[')
+		for i, elem := range elems {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			if dst, err = appendCanonicalValue(dst, elem); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, ']'), nil
+	case '"':
+		return append(appendCanonical(append(dst, '"'), value[1:len(value)-1]), '"'), nil
+	}
+	if valueType(value) == "number" {
+		return appendNumber(dst, value), nil
+	}
+	return append(dst, value...), nil
+}
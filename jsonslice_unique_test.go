@@ -0,0 +1,179 @@
+package jsonslice
+
+import "testing"
+
+func Test_GetUnique(t *testing.T) {
+
+	doc := []byte(`{"a":{"r":{"id":1,"tags":["x","y"]}},"b":[{"r":{ "tags" : [ "x", "y" ], "id" : 1.0 }},{"r":{"id":2}}],"c":{"r":{"id":1,"tags":["y","x"]}},"d":{"r":"A"},"e":{"r":"\u0041"}}`)
+
+	tests := []struct {
+		Query    string
+		Expected string
+	}{
+		// the objects differing only in key order, whitespace and number notation collapse to the first one
+		{`$..r`, `[{"id":1,"tags":["x","y"]},{"id":2},{"id":1,"tags":["y","x"]},"A"]`},
+		{`$..id`, `[1,2]`},
+		{`$.*.r.tags`, `[["x","y"],["y","x"]]`},
+		{`$.b[:].r.id`, `[1.0,2]`},
+		{`$..tags[*]`, `["x","y"]`},
+		{`$..x`, `[]`},
+		// not an aggregate
+		{`$.b[0].r.tags`, `[ "x", "y" ]`},
+		// fallback chain
+		{`$.zz ?? $..id`, `[1,2]`},
+		{`$.zz ?? $.b[0].r.tags`, `[ "x", "y" ]`},
+		{`$.zz ?? 'none'`, `"none"`},
+		{`$.zz ?? $.b[`, `path: index bound missing at 12`},
+	}
+
+	for _, tst := range tests {
+		res, err := GetUnique(doc, tst.Query)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Query + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
+
+func Test_GetChecksum(t *testing.T) {
+
+	a := []byte(`{"v":1,"cfg":{"name":"x","ports":[80,443],"opts":{"a":true,"b":null}},"list":[{"id":1},{"id":2}]}`)
+	b := []byte(`{
+		"list": [ {"id": 1.0}, {"id": 2} ],
+		"cfg": { "opts": { "b": null, "a": true }, "ports": [ 8e1, 443 ], "name": "x" },
+		"v": 2
+	}`)
+
+	equal := []string{`$.cfg`, `$.cfg.ports`, `$.cfg.opts`, `$.list`, `$.list[*].id`, `$..id`, `$.list[?(@.x)]`}
+	for _, query := range equal {
+		sa, errA := GetChecksum(a, query)
+		sb, errB := GetChecksum(b, query)
+		if errA != nil || errB != nil || sa != sb {
+			t.Errorf(query+" : checksums differ: %x (%v), %x (%v)", sa, errA, sb, errB)
+		}
+	}
+
+	differ := []string{`$.v`, `$`}
+	for _, query := range differ {
+		sa, errA := GetChecksum(a, query)
+		sb, errB := GetChecksum(b, query)
+		if errA != nil || errB != nil || sa == sb {
+			t.Errorf(query+" : checksums are equal: %x (%v), %x (%v)", sa, errA, sb, errB)
+		}
+	}
+
+	// the order of array elements matters
+	sa, _ := GetChecksum([]byte(`[1,2]`), `$`)
+	sb, _ := GetChecksum([]byte(`[2,1]`), `$`)
+	if sa == sb {
+		t.Errorf("array order ignored")
+	}
+	if _, err := GetChecksum(a, `$.x`); err == nil {
+		t.Errorf("$.x : error expected")
+	}
+}
+
+func Test_Equal(t *testing.T) {
+
+	doc := []byte(`{
+		"header": {"total": 10, "cur": "EUR", "rows": [{"a":1,"b":2}]},
+		"summary": {"total": 1e1, "cur": "\u0045UR", "rows": [{ "b": 2.0, "a": 1 }]},
+		"other": {"total": 11, "rows": [{"a":1,"b":3}]}
+	}`)
+
+	tests := []struct {
+		A, B     string
+		Expected bool
+	}{
+		{`$.header.total`, `$.summary.total`, true},
+		{`$.header.cur`, `$.summary.cur`, true},
+		{`$.header.rows`, `$.summary.rows`, true},
+		{`$.header.rows[0]`, `$.other.rows[0]`, false},
+		{`$.header.total`, `$.other.total`, false},
+		{`$.header.rows[*].a`, `$.other.rows[*].a`, true},
+		{`$.header`, `$.summary`, true},
+		{`$.header`, `$.other`, false},
+	}
+
+	for _, tst := range tests {
+		equal, err := Equal(doc, tst.A, tst.B)
+		if err != nil || equal != tst.Expected {
+			t.Errorf(tst.A+" == "+tst.B+" : expected %v but got %v (%v)", tst.Expected, equal, err)
+		}
+	}
+
+	if _, err := Equal(doc, `$.header.total`, `$.summary.x`); err == nil {
+		t.Errorf("$.summary.x : error expected")
+	}
+}
+
+func Test_CountDistinct(t *testing.T) {
+
+	doc := []byte(`{"events":[
+		{"user":"ann","tags":{"a":1,"b":2}},
+		{"user":"bob","tags":{"b":2,"a":1.0}},
+		{"user":"ann"},
+		{"user":"ann","tags":[1]},
+		{"tags":null},
+		{"user":7},
+		"noise"
+	],"obj":{}}`)
+
+	tests := map[string]int{
+		"user":    3, // "ann", "bob", 7
+		"tags":    3, // {"a":1,"b":2}, [1], null
+		"missing": 0,
+	}
+
+	for field, expected := range tests {
+		n, err := CountDistinct(doc, `$.events`, field)
+		if err != nil || n != expected {
+			t.Errorf(field+" : expected %d, got %d (%v)", expected, n, err)
+		}
+	}
+
+	if n, err := CountDistinct(doc, `$.events[?(@.tags)]`, "user"); err != nil || n != 2 {
+		t.Errorf("$.events[?(@.tags)] : expected 2, got %d (%v)", n, err)
+	}
+	if _, err := CountDistinct(doc, `$.obj`, "user"); err != errArrayExpected {
+		t.Errorf("$.obj : unexpected error %v", err)
+	}
+}
+
+func Test_GroupBy(t *testing.T) {
+
+	doc := []byte(`{"orders":[
+		{"id":1,"status":"paid"},
+		{"id":2,"status":"new"},
+		{"id":3,"status":"paid"},
+		{"id":4},
+		{"id":5,"status":"new"},
+		{"id":6,"status":1},
+		{"id":7,"status":1.0}
+	],"empty":[],"obj":{}}`)
+
+	tests := []struct {
+		Path     string
+		Field    string
+		Expected string
+	}{
+		{`$.orders`, "status", `{"paid":[{"id":1,"status":"paid"},{"id":3,"status":"paid"}],"new":[{"id":2,"status":"new"},{"id":5,"status":"new"}],"1":[{"id":6,"status":1},{"id":7,"status":1.0}]}`},
+		{`$.orders[?(@.id > 2)]`, "status", `{"paid":[{"id":3,"status":"paid"}],"new":[{"id":5,"status":"new"}],"1":[{"id":6,"status":1},{"id":7,"status":1.0}]}`},
+		{`$.orders[:2]`, "id", `{"1":[{"id":1,"status":"paid"}],"2":[{"id":2,"status":"new"}]}`},
+		{`$.orders`, "missing", `{}`},
+		{`$.empty`, "status", `{}`},
+		{`$.obj`, "status", `array expected`},
+	}
+
+	for _, tst := range tests {
+		res, err := GroupBy(doc, tst.Path, tst.Field)
+		if err != nil {
+			res = []byte(err.Error())
+		}
+		if string(res) != tst.Expected {
+			t.Errorf(tst.Path + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + string(res) + "`")
+		}
+	}
+}
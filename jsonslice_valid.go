@@ -0,0 +1,262 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Valid reports whether input is a single well-formed json value
+func Valid(input []byte) bool {
+	return Validate(input) == nil
+}
+
+// Validate checks that input is a single well-formed json value, optionally surrounded by whitespace.
+// Unlike the scanners used by Get it is strict: commas, colons, numbers and escapes are all checked.
+// Like json.Valid it does not check for invalid UTF-8.
+// The error is supplemented with its position.
+func Validate(input []byte) error {
+	i, err := validValue(input, validSpaces(input, 0))
+	if err == nil {
+		if i = validSpaces(input, i); i < len(input) {
+			err = errTrailingData
+		}
+	}
+	if err != nil {
+		return errors.New(err.Error() + " at " + strconv.Itoa(i))
+	}
+	return nil
+}
+
+// ValidatePath checks the syntax of jsonpath without running it, a ?? fallback chain included.
+// The error is the one Get would report, supplemented with its position.
+func ValidatePath(path string) error {
+	if len(path) == 0 {
+		return errPathEmpty
+	}
+	if strings.Contains(path, "??") {
+		if alts := fallbacks(path); len(alts) > 1 {
+			nodes, _, err := compileFallbacks(path, alts, nil)
+			repoolAll(nodes)
+			return err
+		}
+	}
+	node, err := compilePath(path, nil)
+	repool(node)
+	return err
+}
+
+// CheckShape verifies that the object matching jsonpath has every key of shape with a value of the given json type:
+// object, array, string, number, boolean or null, like {"id":"number","name":"string"}. Other keys are not checked.
+// The keys are checked in lexical order, the first missing or mistyped one is reported.
+func CheckShape(input []byte, path string, shape map[string]string) error {
+	value, err := Get(input, path)
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 || value[0] != '{' {
+		return errObjectExpected
+	}
+	keys, vals, err := objectMembers(value)
+	if err != nil {
+		return err
+	}
+	members := make(map[string][]byte, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		members[string(keys[i])] = vals[i] // the first of duplicate keys
+	}
+	names := make([]string, 0, len(shape))
+	for name := range shape {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		want := shape[name]
+		switch want {
+		case "object", "array", "string", "number", "boolean", "null":
+		default:
+			return errors.New("shape: unknown type '" + want + "' of key '" + name + "'")
+		}
+		val, ok := members[name]
+		if !ok {
+			return errors.New("shape: key '" + name + "' missing")
+		}
+		if got := valueType(val); got != want {
+			return errors.New("shape: key '" + name + "' is " + got + ", " + want + " expected")
+		}
+	}
+	return nil
+}
+
+// validSpaces skips json whitespace (commas are not whitespace here)
+func validSpaces(input []byte, i int) int {
+	for i < len(input) && (input[i] == ' ' || input[i] == '\t' || input[i] == '\r' || input[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// validValue checks the value starting at i and returns the position right after it
+func validValue(input []byte, i int) (int, error) {
+	if i >= len(input) {
+		return i, errUnexpectedEnd
+	}
+	switch ch := input[i]; {
+	case ch == '{':
+		return validObject(input, i)
+	case ch == '[':
+		return validArray(input, i)
+	case ch == '"':
+		return validString(input, i)
+	case ch == '-' || (ch >= '0' && ch <= '9'):
+		return validNumber(input, i)
+	}
+	return skipBoolNull(input, i)
+}
+
+func validObject(input []byte, i int) (int, error) {
+	var err error
+	i = validSpaces(input, i+1)
+	if i < len(input) && input[i] == '}' {
+		return i + 1, nil
+	}
+	for {
+		if i >= len(input) {
+			return i, errUnexpectedEnd
+		}
+		if input[i] != '"' {
+			return i, errKeyExpected
+		}
+		if i, err = validString(input, i); err != nil {
+			return i, err
+		}
+		if i = validSpaces(input, i); i >= len(input) {
+			return i, errUnexpectedEnd
+		}
+		if input[i] != ':' {
+			return i, errColonExpected
+		}
+		if i, err = validValue(input, validSpaces(input, i+1)); err != nil {
+			return i, err
+		}
+		if i, err = validNext(input, validSpaces(input, i), '}'); err != nil || input[i-1] == '}' {
+			return i, err
+		}
+		i = validSpaces(input, i)
+	}
+}
+
+func validArray(input []byte, i int) (int, error) {
+	var err error
+	i = validSpaces(input, i+1)
+	if i < len(input) && input[i] == ']' {
+		return i + 1, nil
+	}
+	for {
+		if i, err = validValue(input, i); err != nil {
+			return i, err
+		}
+		if i, err = validNext(input, validSpaces(input, i), ']'); err != nil || input[i-1] == ']' {
+			return i, err
+		}
+		i = validSpaces(input, i)
+	}
+}
+
+// validNext expects either a comma or the closing bracket at i
+func validNext(input []byte, i int, closing byte) (int, error) {
+	if i >= len(input) {
+		return i, errUnexpectedEnd
+	}
+	if input[i] != ',' && input[i] != closing {
+		return i, errInvalidCharacter
+	}
+	return i + 1, nil
+}
+
+func validString(input []byte, i int) (int, error) {
+	l := len(input)
+	for i++; i < l; {
+		ch := input[i]
+		switch {
+		case ch == '"':
+			return i + 1, nil
+		case ch == '\\':
+			if i+1 >= l {
+				return i, errUnexpectedEnd
+			}
+			if input[i+1] == 'u' {
+				if i+6 > l {
+					return i, errUnexpectedEnd
+				}
+				for _, h := range input[i+2 : i+6] {
+					if !isHexDigit(h) {
+						return i, errInvalidEscape
+					}
+				}
+				i += 6
+				continue
+			}
+			if !bytein(input[i+1], []byte{'"', '\\', '/', 'b', 'f', 'n', 'r', 't'}) {
+				return i, errInvalidEscape
+			}
+			i += 2
+		case ch < 0x20:
+			return i, errInvalidCharacter
+		default:
+			i++
+		}
+	}
+	return i, errUnexpectedEnd
+}
+
+// validNumber checks -?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?
+func validNumber(input []byte, i int) (int, error) {
+	s := i
+	l := len(input)
+	if input[i] == '-' {
+		i++
+	}
+	digits := func() int {
+		n := 0
+		for ; i < l && input[i] >= '0' && input[i] <= '9'; i++ {
+			n++
+		}
+		return n
+	}
+	if i < l && input[i] == '0' {
+		i++
+	} else if digits() == 0 {
+		return s, errInvalidNumber
+	}
+	if i < l && input[i] == '.' {
+		i++
+		if digits() == 0 {
+			return s, errInvalidNumber
+		}
+	}
+	if i < l && (input[i] == 'e' || input[i] == 'E') {
+		i++
+		if i < l && (input[i] == '+' || input[i] == '-') {
+			i++
+		}
+		if digits() == 0 {
+			return s, errInvalidNumber
+		}
+	}
+	return i, nil
+}
+
+func isHexDigit(ch byte) bool {
+	return (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
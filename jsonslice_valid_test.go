@@ -0,0 +1,131 @@
+package jsonslice
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_Validate(t *testing.T) {
+
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		// valid
+		{`{"a": [1, -2.5e+3, 0.1, "x\"\\\/\b\f\n\r\tüé"], "b": {}, "c": [], "d": true, "e": false, "f": null}`, ``},
+		{string(data), ``},
+		{`  "str"  `, ``},
+		{`0`, ``},
+		{"\n[ ]\n", ``},
+		// truncated
+		{``, `unexpected end of input at 0`},
+		{`{"a": [1, 2`, `unexpected end of input at 11`},
+		{`{"a": "x`, `unexpected end of input at 8`},
+		{`{"a"`, `unexpected end of input at 4`},
+		// trailing garbage
+		{`{"a": 1} x`, `unexpected data after the value at 9`},
+		{`{} {}`, `unexpected data after the value at 3`},
+		{`truex`, `unexpected data after the value at 4`},
+		// malformed
+		{`{"a" 1}`, `':' expected at 5`},
+		{`{"a": 1 "b": 2}`, `invalid character at 8`},
+		{`[1 2]`, `invalid character at 3`},
+		{`{"a": 1,}`, `object key expected at 8`},
+		{`{a: 1}`, `object key expected at 1`},
+		{`[01]`, `invalid character at 2`},
+		{`[1.]`, `invalid number at 1`},
+		{`[-]`, `invalid number at 1`},
+		{`{"x": +5}`, `unrecognized value: true, false or null expected at 6`},
+		{`["\x"]`, `invalid escape sequence at 2`},
+		{`["\u12G4"]`, `invalid escape sequence at 2`},
+		{"[\"a\tb\"]", `invalid character at 3`},
+		{`[nul]`, `unrecognized value: true, false or null expected at 1`},
+	}
+
+	for _, tst := range tests {
+		err := Validate([]byte(tst.Input))
+		res := ""
+		if err != nil {
+			res = err.Error()
+		}
+		if res != tst.Expected {
+			t.Errorf("Validate %s\n\texpected `%s`\n\tbut got  `%s`", tst.Input, tst.Expected, res)
+		}
+		if Valid([]byte(tst.Input)) != json.Valid([]byte(tst.Input)) {
+			t.Errorf("Valid %s : differs from json.Valid", tst.Input)
+		}
+	}
+}
+
+func Test_ValidatePath(t *testing.T) {
+
+	tests := []struct {
+		Path  string
+		Error string
+	}{
+		{`$`, ``},
+		{`$.store.book[?(@.price > 10)].title`, ``},
+		{`$..book[0:2:-1]`, ``},
+		{`$.a.b ?? $.c ?? 'none'`, ``},
+		{``, `path: empty`},
+		{`store`, `path: $ expected`},
+		{`$.a[`, `path: index bound missing at 4`},
+		{`$.store.book[?(1+)]`, `not enough arguments at 17`},
+		{`$.a ?? $.b[`, `path: index bound missing at 11`},
+		{`$.a ?? 1x`, `path: invalid fallback value at 7`},
+		{`$.a xyz`, `path: unexpected text at 4`},
+		{`$.a[0]  $.b `, `path: unexpected text at 8`},
+		{`$.a ?? $.b c`, `path: unexpected text at 11`},
+	}
+
+	for _, tst := range tests {
+		err := ValidatePath(tst.Path)
+		if tst.Error == "" {
+			if err != nil {
+				t.Errorf(tst.Path+" : unexpected error %v", err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tst.Error {
+			t.Errorf(tst.Path+"\n\texpected error `%s`\n\tbut got  `%v`", tst.Error, err)
+			continue
+		}
+		// the same error as Get reports
+		if _, getErr := Get([]byte(`{}`), tst.Path); getErr == nil || getErr.Error() != err.Error() {
+			t.Errorf(tst.Path+" : Get reports %v", getErr)
+		}
+	}
+}
+
+func Test_CheckShape(t *testing.T) {
+
+	doc := []byte(`{"users":[{"id":1,"name":"ann","tags":[],"meta":{"x":null},"on":true},{"id":"2","name":"bob"}],"n":5}`)
+	shape := map[string]string{"id": "number", "name": "string", "tags": "array", "meta": "object", "on": "boolean"}
+
+	tests := []struct {
+		Path     string
+		Shape    map[string]string
+		Expected string
+	}{
+		{`$.users[0]`, shape, ``},
+		{`$.users[0]`, map[string]string{"id": "number"}, ``},
+		{`$.users[0].meta`, map[string]string{"x": "null"}, ``},
+		{`$.users[1]`, map[string]string{"id": "number", "name": "string"}, `shape: key 'id' is string, number expected`},
+		{`$.users[1]`, shape, `shape: key 'id' is string, number expected`},
+		{`$.users[1]`, map[string]string{"name": "string", "tags": "array"}, `shape: key 'tags' missing`},
+		{`$.users[0]`, map[string]string{"id": "integer"}, `shape: unknown type 'integer' of key 'id'`},
+		{`$.n`, shape, `object expected`},
+		{`$.users[5]`, shape, `specified array element not found`},
+	}
+
+	for _, tst := range tests {
+		err := CheckShape(doc, tst.Path, tst.Shape)
+		res := ""
+		if err != nil {
+			res = err.Error()
+		}
+		if res != tst.Expected {
+			t.Errorf(tst.Path + "\n\texpected `" + tst.Expected + "`\n\tbut got  `" + res + "`")
+		}
+	}
+}
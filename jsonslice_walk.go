@@ -0,0 +1,175 @@
+package jsonslice
+
+/**
+  JsonSlice 0.7.4
+  Michael Gurov, 2018-2019
+  MIT licenced
+
+  Slice a part of a raw json ([]byte) using jsonpath, without unmarshalling the whole thing.
+  The result is also []byte.
+**/
+
+import "strconv"
+
+// Walk visits every value of input in document order (parents before children)
+// calling fn with its canonical jsonpath and raw value. Returning false from fn stops the walk.
+// Keys consisting of word characters are dot-notated, all others are bracket-notated:
+// $, $.store, $.store.book, $.store.book[0], $.store['my key']
+func Walk(input []byte, fn func(path string, value []byte) bool) error {
+	value, err := rootValue(input)
+	if err != nil {
+		return err
+	}
+	path := make([]byte, 1, 64)
+	path[0] = '$'
+	_, err = walk(value, path, fn)
+	return err
+}
+
+// Flatten returns every leaf value of the subtree matching jsonpath keyed by its path relative to the subtree:
+// {"a":{"b":[{"c":1}]}} is flattened to a.b[0].c => 1. Scalars, empty objects and empty arrays are leaves.
+// A scalar subtree is returned under the empty key.
+func Flatten(input []byte, path string) (map[string][]byte, error) {
+	value, err := Get(input, path)
+	if err != nil {
+		return nil, err
+	}
+	leaves := make(map[string][]byte)
+	err = Walk(value, func(path string, value []byte) bool {
+		if !isLeaf(value) {
+			return true
+		}
+		path = path[1:] // $
+		if len(path) > 0 && path[0] == '.' {
+			path = path[1:]
+		}
+		leaves[path] = value
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return leaves, nil
+}
+
+// isLeaf reports whether value is a scalar or an empty object or array
+func isLeaf(value []byte) bool {
+	if value[0] != '{' && value[0] != '[' {
+		return true
+	}
+	i, err := skipSpaces(value, 1)
+	return err == nil && (value[i] == '}' || value[i] == ']')
+}
+
+// rootValue returns the top-level value of input without the surrounding whitespace
+func rootValue(input []byte) ([]byte, error) {
+	i, err := skipSpaces(input, 0)
+	if err != nil {
+		return nil, err
+	}
+	e, err := skipValue(input, i)
+	if err != nil {
+		return nil, err
+	}
+	return input[i:e], nil
+}
+
+// walk calls fn for value and all of its descendants. Returns false if the walk has been stopped.
+func walk(value []byte, path []byte, fn func(path string, value []byte) bool) (bool, error) {
+	if !fn(string(path), value) {
+		return false, nil
+	}
+	switch value[0] {
+	case '{':
+		return walkObject(value, path, fn)
+	case '[':
+		return walkArray(value, path, fn)
+	}
+	return true, nil
+}
+
+func walkObject(input []byte, path []byte, fn func(path string, value []byte) bool) (bool, error) {
+	i, err := skipSpaces(input, 1)
+	if err != nil {
+		return false, err
+	}
+	for input[i] != '}' {
+		if input[i] != '"' {
+			return false, errKeyExpected
+		}
+		e, err := skipString(input, i)
+		if err != nil {
+			return false, err
+		}
+		key := input[i+1 : e-1]
+		if i, err = seekToValue(input, e); err != nil {
+			return false, err
+		}
+		if e, err = skipValue(input, i); err != nil {
+			return false, err
+		}
+		more, err := walk(input[i:e], appendKey(path, key), fn)
+		if !more || err != nil {
+			return false, err
+		}
+		if i, err = skipSpaces(input, e); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func walkArray(input []byte, path []byte, fn func(path string, value []byte) bool) (bool, error) {
+	i, err := skipSpaces(input, 1)
+	if err != nil {
+		return false, err
+	}
+	for n := 0; input[i] != ']'; n++ {
+		e, err := skipValue(input, i)
+		if err != nil {
+			return false, err
+		}
+		more, err := walk(input[i:e], appendIndex(path, n), fn)
+		if !more || err != nil {
+			return false, err
+		}
+		if i, err = skipSpaces(input, e); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// appendKey appends .key or ['key'] to the path.
+// A single quote within ['key'] is escaped as \', the backslashes are json escapes already and are kept as is.
+func appendKey(path []byte, key []byte) []byte {
+	for _, ch := range key {
+		if !isWordChar(ch) {
+			return append(appendQuotedKey(append(path, '[', '\''), key), '\'', ']')
+		}
+	}
+	if len(key) == 0 {
+		return append(path, '[', '\'', '\'', ']')
+	}
+	return append(append(path, '.'), key...)
+}
+
+// appendQuotedKey appends the key escaping the single quotes
+func appendQuotedKey(path []byte, key []byte) []byte {
+	for _, ch := range key {
+		if ch == '\'' {
+			path = append(path, '\\')
+		}
+		path = append(path, ch)
+	}
+	return path
+}
+
+// appendIndex appends [n] to the path
+func appendIndex(path []byte, n int) []byte {
+	return append(strconv.AppendInt(append(path, '['), int64(n), 10), ']')
+}
+
+func isWordChar(ch byte) bool {
+	return ch == '_' || (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
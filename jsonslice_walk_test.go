@@ -0,0 +1,109 @@
+package jsonslice
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_Walk(t *testing.T) {
+
+	input := []byte(`{"a": {"b": [1, {"c": true}], "my key": null}, "d": [], "e": ""}`)
+	expected := []string{
+		`$`, `{"a": {"b": [1, {"c": true}], "my key": null}, "d": [], "e": ""}`,
+		`$.a`, `{"b": [1, {"c": true}], "my key": null}`,
+		`$.a.b`, `[1, {"c": true}]`,
+		`$.a.b[0]`, `1`,
+		`$.a.b[1]`, `{"c": true}`,
+		`$.a.b[1].c`, `true`,
+		`$.a['my key']`, `null`,
+		`$.d`, `[]`,
+		`$.e`, `""`,
+	}
+
+	var got []string
+	err := Walk(input, func(path string, value []byte) bool {
+		got = append(got, path, string(value))
+		return true
+	})
+	if err != nil {
+		t.Errorf("Walk : " + err.Error())
+	} else if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Walk\n\texpected `%v`\n\tbut got  `%v`", expected, got)
+	}
+
+	// stop walking
+	n := 0
+	err = Walk(input, func(path string, value []byte) bool {
+		n++
+		return path != `$.a.b`
+	})
+	if err != nil || n != 3 {
+		t.Errorf("Walk : expected to stop after 3 nodes, stopped after %d (%v)", n, err)
+	}
+
+	// the paths lead back to the values, whatever the keys are
+	keys := []byte(`{"it's":1,"a\\b":2,"q\"x":[3],"x\\":4,"\\'":{"'":5}}`)
+	err = Walk(keys, func(path string, value []byte) bool {
+		if res, err := Get(keys, path); err != nil || string(res) != string(value) {
+			t.Errorf(path+" : expected `%s`, got `%s` (%v)", value, res, err)
+		}
+		return true
+	})
+	if err != nil {
+		t.Errorf("Walk : " + err.Error())
+	}
+
+	// malformed input
+	err = Walk([]byte(`{"a": [1, 2}`), func(path string, value []byte) bool { return true })
+	if err == nil {
+		t.Errorf("Walk : error expected")
+	}
+}
+
+func Test_Flatten(t *testing.T) {
+
+	doc := []byte(`{"a":{"b":[{"c":1},{"d":[true,null]}],"e":{}},"f g":"x","h":[]}`)
+
+	tests := []struct {
+		Query    string
+		Expected map[string]string
+	}{
+		{`$`, map[string]string{
+			"a.b[0].c":    `1`,
+			"a.b[1].d[0]": `true`,
+			"a.b[1].d[1]": `null`,
+			"a.e":         `{}`,
+			"['f g']":     `"x"`,
+			"h":           `[]`,
+		}},
+		{`$.a.b`, map[string]string{
+			"[0].c":    `1`,
+			"[1].d[0]": `true`,
+			"[1].d[1]": `null`,
+		}},
+		{`$.a.b[0].c`, map[string]string{"": `1`}},
+		{`$.missing`, nil},
+	}
+
+	for _, tst := range tests {
+		res, err := Flatten(doc, tst.Query)
+		if tst.Expected == nil {
+			if err == nil {
+				t.Errorf(tst.Query + " : error expected")
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf(tst.Query + " : " + err.Error())
+			continue
+		}
+		if len(res) != len(tst.Expected) {
+			t.Errorf(tst.Query+" : expected %d leaves, got %d", len(tst.Expected), len(res))
+		}
+		for key, val := range tst.Expected {
+			if string(res[key]) != val {
+				t.Errorf(tst.Query + " : " + key + "\n\texpected `" + val + "`\n\tbut got  `" + string(res[key]) + "`")
+			}
+		}
+	}
+}
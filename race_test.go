@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package jsonslice
+
+// raceEnabled reports whether the tests are run with the race detector
+const raceEnabled = true